@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Activation modes of a tenant's backend
+const (
+	// ActivationProxy: rest-api.socket starts systemd-socket-proxyd, which forwards
+	// to the backend on 127.0.0.1:PORT. Works with every application.
+	ActivationProxy = "proxy"
+	// ActivationDirect: rest-api.socket passes the listening socket to the backend
+	// (LISTEN_FDS). The backend must accept inherited sockets and exit when idle.
+	ActivationDirect = "direct"
+)
+
+// ValidateActivation checks an activation mode; empty selects the proxy mode
+func ValidateActivation(mode string) error {
+	switch mode {
+	case "", ActivationProxy, ActivationDirect:
+		return nil
+	}
+	return fmt.Errorf("invalid activation mode '%s' (must be proxy or direct)", mode)
+}
+
+// activationOrDefault returns the effective activation mode of a tenant
+func activationOrDefault(mode string) string {
+	if mode == "" {
+		return ActivationProxy
+	}
+	return mode
+}
+
+// SetTenantActivation stores the activation mode of a tenant
+func SetTenantActivation(username, mode string) error {
+	if err := ValidateActivation(mode); err != nil {
+		return err
+	}
+	if err := UpdateTenant(username, func(t *TenantRecord) { t.Activation = mode }); err != nil {
+		return fmt.Errorf("failed to update tenant inventory: %v", err)
+	}
+	return nil
+}
+
+var timeSpanRegex = regexp.MustCompile(`^\s*([0-9]+)\s*([a-z]*)`)
+
+// Units of systemd.time(7) time spans, without months and years
+var timeSpanUnits = map[string]time.Duration{
+	"us": time.Microsecond, "usec": time.Microsecond,
+	"ms": time.Millisecond, "msec": time.Millisecond,
+	"": time.Second, "s": time.Second, "sec": time.Second, "second": time.Second, "seconds": time.Second,
+	"m": time.Minute, "min": time.Minute, "minute": time.Minute, "minutes": time.Minute,
+	"h": time.Hour, "hr": time.Hour, "hour": time.Hour, "hours": time.Hour,
+	"d": 24 * time.Hour, "day": 24 * time.Hour, "days": 24 * time.Hour,
+	"w": 7 * 24 * time.Hour, "week": 7 * 24 * time.Hour, "weeks": 7 * 24 * time.Hour,
+}
+
+// parseTimeSpan parses a systemd time span such as "10s", "5min" or "1h 30min".
+// The direct mode hands the idle timeout to the backend, which has no systemd parser.
+func parseTimeSpan(s string) (time.Duration, error) {
+	rest := strings.TrimSpace(s)
+	if rest == "" {
+		return 0, fmt.Errorf("empty time span")
+	}
+
+	var total time.Duration
+	for rest != "" {
+		m := timeSpanRegex.FindStringSubmatch(rest)
+		if m == nil {
+			return 0, fmt.Errorf("invalid time span '%s'", s)
+		}
+		unit, ok := timeSpanUnits[m[2]]
+		if !ok {
+			return 0, fmt.Errorf("invalid time span '%s': unknown unit '%s'", s, m[2])
+		}
+		n, err := strconv.Atoi(m[1])
+		if err != nil {
+			return 0, fmt.Errorf("invalid time span '%s': %v", s, err)
+		}
+		total += time.Duration(n) * unit
+		rest = strings.TrimSpace(rest[len(m[0]):])
+	}
+	return total, nil
+}
@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseTimeSpan(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"10s", 10 * time.Second, false},
+		{"5min", 5 * time.Minute, false},
+		{"1h 30min", 90 * time.Minute, false},
+		{"2h30m", 150 * time.Minute, false},
+		{"90", 90 * time.Second, false},
+		{"", 0, true},
+		{"5 parsecs", 0, true},
+		{"min", 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseTimeSpan(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("parseTimeSpan(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+		}
+		if got != tt.want {
+			t.Errorf("parseTimeSpan(%q) = %v, want %v", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestRenderUnitsDirect(t *testing.T) {
+	config := SystemdConfig{Username: "alice", Port: 11000, IdleTime: "5min"}
+	config.setApp(nil)
+	if err := config.setDirect("5min"); err != nil {
+		t.Fatal(err)
+	}
+
+	units, err := renderUnits(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := units["rest-api-proxy.service"]; ok {
+		t.Error("direct mode rendered the proxy unit")
+	}
+	if !strings.Contains(units["rest-api.socket"], "Service=rest-api.service") {
+		t.Errorf("socket does not activate the backend:\n%s", units["rest-api.socket"])
+	}
+	service := units["rest-api.service"]
+	if !strings.Contains(service, "Environment=IDLE_TIMEOUT=5m0s") || strings.Contains(service, "PORT=") || strings.Contains(service, "StopWhenUnneeded") {
+		t.Errorf("unexpected backend unit:\n%s", service)
+	}
+}
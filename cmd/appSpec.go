@@ -0,0 +1,207 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// Binary used when a tenant does not specify its own application
+const defaultAppCommand = "/usr/local/bin/user-rest-api"
+
+var envKeyRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// AppSpec describes the application a tenant runs behind its socket
+type AppSpec struct {
+	Command    string            `json:"command" yaml:"command"`
+	Args       []string          `json:"args,omitempty" yaml:"args"`
+	WorkingDir string            `json:"working_dir,omitempty" yaml:"working_dir"`
+	Env        map[string]string `json:"env,omitempty" yaml:"env"`
+}
+
+// Validate checks that the spec can be rendered into a unit file
+func (a *AppSpec) Validate() error {
+	if !filepath.IsAbs(a.Command) {
+		return fmt.Errorf("app command '%s' must be an absolute path", a.Command)
+	}
+	if a.WorkingDir != "" && !filepath.IsAbs(a.WorkingDir) {
+		return fmt.Errorf("working directory '%s' must be an absolute path", a.WorkingDir)
+	}
+	for key := range a.Env {
+		if !envKeyRegex.MatchString(key) {
+			return fmt.Errorf("invalid environment variable name '%s'", key)
+		}
+		// PORT is how pilot tells the app where to listen
+		if key == "PORT" {
+			return fmt.Errorf("environment variable PORT is managed by pilot")
+		}
+	}
+	return nil
+}
+
+// ExecStart renders the command line for the unit's ExecStart= directive.
+// "$" is escaped so systemd does not expand it as an environment variable.
+func (a *AppSpec) ExecStart() string {
+	parts := []string{systemdQuote(a.Command)}
+	for _, arg := range a.Args {
+		parts = append(parts, systemdQuote(strings.ReplaceAll(arg, "$", "$$")))
+	}
+	return strings.Join(parts, " ")
+}
+
+// Environment renders the app's variables as quoted Environment= assignments, sorted by name
+func (a *AppSpec) Environment() []string {
+	keys := make([]string, 0, len(a.Env))
+	for k := range a.Env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	env := make([]string, len(keys))
+	for i, k := range keys {
+		env[i] = systemdQuote(k + "=" + a.Env[k])
+	}
+	return env
+}
+
+// appOrDefault returns the app spec, falling back to the demo application
+func appOrDefault(a *AppSpec) *AppSpec {
+	if a == nil {
+		return &AppSpec{Command: defaultAppCommand}
+	}
+	return a
+}
+
+// systemdQuote quotes a word for use in unit files. Specifiers (%) are always
+// escaped; words with whitespace, quotes or backslashes are double-quoted.
+func systemdQuote(s string) string {
+	s = strings.ReplaceAll(s, "%", "%%")
+	if s != "" && !strings.ContainsAny(s, " \t\n\"'\\;") {
+		return s
+	}
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\t", `\t`)
+	return `"` + r.Replace(s) + `"`
+}
+
+// splitCommandLine splits a command line into words, honoring single quotes,
+// double quotes and backslash escapes like a POSIX shell (without expansion)
+func splitCommandLine(s string) ([]string, error) {
+	var words []string
+	var cur strings.Builder
+	inWord := false
+	var quote rune
+
+	runes := []rune(s)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				cur.WriteRune(r)
+			}
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else if r == '\\' && i+1 < len(runes) && strings.ContainsRune(`"\$`+"`", runes[i+1]) {
+				i++
+				cur.WriteRune(runes[i])
+			} else {
+				cur.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inWord = true
+		case r == '\\':
+			if i+1 >= len(runes) {
+				return nil, fmt.Errorf("trailing backslash in command line")
+			}
+			i++
+			cur.WriteRune(runes[i])
+			inWord = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				words = append(words, cur.String())
+				cur.Reset()
+				inWord = false
+			}
+		default:
+			cur.WriteRune(r)
+			inWord = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote in command line")
+	}
+	if inWord {
+		words = append(words, cur.String())
+	}
+	return words, nil
+}
+
+// appFlags holds the application flags shared by create-tenant and setup-systemd
+type appFlags struct {
+	command string
+	args    []string
+	workDir string
+	env     []string
+}
+
+func addAppFlags(cmd *cobra.Command, f *appFlags) {
+	cmd.Flags().StringVar(&f.command, "app", "", "Application binary or command line (default "+defaultAppCommand+")")
+	cmd.Flags().StringArrayVar(&f.args, "app-arg", nil, "Additional argument for the application (repeatable)")
+	cmd.Flags().StringVar(&f.workDir, "workdir", "", "Working directory of the application")
+	cmd.Flags().StringArrayVar(&f.env, "env", nil, "Environment variable KEY=VALUE for the application (repeatable)")
+}
+
+// spec builds an AppSpec from the flags. It returns nil if no app flag was given,
+// which keeps the tenant's stored application.
+func (f *appFlags) spec() (*AppSpec, error) {
+	if f.command == "" && len(f.args) == 0 && f.workDir == "" && len(f.env) == 0 {
+		return nil, nil
+	}
+
+	app := &AppSpec{Command: defaultAppCommand, WorkingDir: f.workDir}
+	if f.command != "" {
+		words, err := splitCommandLine(f.command)
+		if err != nil {
+			return nil, err
+		}
+		if len(words) == 0 {
+			return nil, fmt.Errorf("empty app command")
+		}
+		app.Command = words[0]
+		app.Args = words[1:]
+	}
+	app.Args = append(app.Args, f.args...)
+
+	for _, kv := range f.env {
+		key, value, ok := strings.Cut(kv, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid --env '%s' (expected KEY=VALUE)", kv)
+		}
+		if app.Env == nil {
+			app.Env = map[string]string{}
+		}
+		app.Env[key] = value
+	}
+
+	if err := app.Validate(); err != nil {
+		return nil, err
+	}
+	return app, nil
+}
+
+// SetTenantApp stores the application spec of a tenant in the inventory
+func SetTenantApp(username string, app *AppSpec) error {
+	if err := UpdateTenant(username, func(t *TenantRecord) { t.App = app }); err != nil {
+		return fmt.Errorf("failed to update tenant inventory: %v", err)
+	}
+	return nil
+}
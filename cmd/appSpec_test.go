@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitCommandLine(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []string
+		wantErr bool
+	}{
+		{"Simple", "/usr/bin/app --port 80", []string{"/usr/bin/app", "--port", "80"}, false},
+		{"Single quotes", "/bin/app 'hello world'", []string{"/bin/app", "hello world"}, false},
+		{"Double quotes", `/bin/app "say \"hi\""`, []string{"/bin/app", `say "hi"`}, false},
+		{"Escaped space", `/bin/app a\ b`, []string{"/bin/app", "a b"}, false},
+		{"Empty quoted arg", "/bin/app ''", []string{"/bin/app", ""}, false},
+		{"Unterminated", "/bin/app 'oops", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := splitCommandLine(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("splitCommandLine(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitCommandLine(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAppSpecRendering(t *testing.T) {
+	app := &AppSpec{
+		Command: "/opt/app/server",
+		Args:    []string{"--greeting", "hello world", "100%", "$HOME"},
+		Env:     map[string]string{"B": "two words", "A": "1"},
+	}
+
+	wantExec := `/opt/app/server --greeting "hello world" 100%% $$HOME`
+	if got := app.ExecStart(); got != wantExec {
+		t.Errorf("ExecStart() = %s, want %s", got, wantExec)
+	}
+
+	wantEnv := []string{"A=1", `"B=two words"`}
+	if got := app.Environment(); !reflect.DeepEqual(got, wantEnv) {
+		t.Errorf("Environment() = %q, want %q", got, wantEnv)
+	}
+
+	if err := (&AppSpec{Command: "server"}).Validate(); err == nil {
+		t.Error("Validate() accepted a relative command")
+	}
+	if err := (&AppSpec{Command: "/bin/x", Env: map[string]string{"PORT": "1"}}).Validate(); err == nil {
+		t.Error("Validate() accepted PORT in env")
+	}
+}
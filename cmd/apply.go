@@ -0,0 +1,491 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/user"
+	"slices"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	applyFile  string
+	applyPrune bool
+)
+
+// Manifest is the desired set of tenants, e.g. kept in git
+type Manifest struct {
+	Tenants []TenantSpec `yaml:"tenants"`
+}
+
+// TenantSpec is the desired configuration of a single tenant
+type TenantSpec struct {
+	Name       string          `yaml:"name"`
+	Domains    []string        `yaml:"domains"`
+	Idle       string          `yaml:"idle"`
+	App        *AppSpec        `yaml:"app"`
+	Limits     *ResourceLimits `yaml:"limits"`
+	Hardening  string          `yaml:"hardening"`
+	Activation string          `yaml:"activation"`
+	Database   *DatabaseLimits `yaml:"database"`
+	Proxy      *ProxyPolicy    `yaml:"proxy"`
+}
+
+// ObservedTenant is what actually exists on the host for a tenant
+type ObservedTenant struct {
+	UserExists     bool
+	Managed        bool
+	RoleExists     bool
+	DatabaseExists bool
+	DBLimitChanges []string          // ALTER ROLE statements needed to apply the limits
+	Units          map[string]string // unit file name -> content on disk ("" if missing)
+	WantUnits      map[string]string // unit file name -> rendered content
+	RouteExists    bool
+	RouteHosts     []string
+	RouteModified  bool // the route differs from the one built from the spec (e.g. its proxy policy)
+}
+
+// ApplyAction is a single change needed to converge a tenant
+type ApplyAction struct {
+	Tenant    string
+	Component string
+	Op        string
+	Reason    string
+}
+
+// Apply operations
+const (
+	OpCreate = "create"
+	OpUpdate = "update"
+	OpDelete = "delete"
+)
+
+var applyCmd = &cobra.Command{
+	Use:   "apply",
+	Short: "Converges the host to a declarative tenants manifest",
+	Long: `Reads a manifest of desired tenants, compares it with the users,
+user units, PostgreSQL roles/databases and Caddy routes on the host
+and creates or updates whatever is missing or different.
+
+With --prune, tenants in the inventory that are not in the manifest
+are deleted.
+
+Example manifest:
+  tenants:
+    - name: alice
+      domains: [alice.example.com, www.alice.example.com]
+      idle: 5min
+      app:
+        command: /opt/alice/bin/server
+        args: [--log-level, info]
+        working_dir: /opt/alice
+        env:
+          APP_ENV: production
+      limits:
+        memory_max: 512M
+        cpu_quota: 50%
+      hardening: strict
+      activation: direct
+      database:
+        connection_limit: "10"
+        statement_timeout: 30s
+        size_quota: 5GB
+      proxy:
+        max_body_size: 10M
+        headers:
+          Strict-Transport-Security: max-age=31536000
+        basic_auth:
+          - username: admin
+            password_hash: $2a$10$...   # bcrypt, e.g. from 'caddy hash-password'
+        allow: [10.0.0.0/8]
+        response_timeout: 60s`,
+	Run: func(cmd *cobra.Command, args []string) {
+		m, err := LoadManifest(applyFile)
+		if err != nil {
+			log.Fatalf("❌ %v", err)
+		}
+
+		LogAction("APPLY", applyFile, "STARTED")
+
+		// 1. Plan
+		plans := map[string][]ApplyAction{}
+		var all []ApplyAction
+		for _, spec := range m.Tenants {
+			obs, err := observeTenant(spec)
+			if err != nil {
+				log.Fatalf("❌ Failed to inspect tenant '%s': %v", spec.Name, err)
+			}
+			if obs.UserExists && !obs.Managed {
+				log.Fatalf("❌ User '%s' exists but is not managed by pilot, refusing to adopt it", spec.Name)
+			}
+			actions := diffTenant(spec, obs)
+			plans[spec.Name] = actions
+			all = append(all, actions...)
+		}
+
+		var pruned []string
+		if applyPrune {
+			pruned, err = pruneCandidates(m)
+			if err != nil {
+				log.Fatalf("❌ %v", err)
+			}
+			for _, name := range pruned {
+				all = append(all, ApplyAction{Tenant: name, Component: "tenant", Op: OpDelete, Reason: "not in manifest"})
+			}
+		}
+
+		if len(all) == 0 {
+			fmt.Println("✅ Everything is up to date.")
+			LogAction("APPLY", applyFile, "SUCCESS")
+			return
+		}
+		printApplyPlan(all)
+
+		// 2. Execute (a failing tenant does not stop the others)
+		failed := false
+		for _, spec := range m.Tenants {
+			if len(plans[spec.Name]) == 0 {
+				continue
+			}
+			fmt.Printf("\n--- Converging tenant '%s' ---\n", spec.Name)
+			if err := applyTenant(spec, plans[spec.Name]); err != nil {
+				log.Printf("❌ Tenant '%s' failed: %v", spec.Name, err)
+				failed = true
+			}
+		}
+		for _, name := range pruned {
+			fmt.Printf("\n--- Pruning tenant '%s' ---\n", name)
+			if err := DeleteTenant(name, false, false); err != nil {
+				log.Printf("❌ Pruning '%s' failed: %v", name, err)
+				failed = true
+			}
+		}
+
+		if failed {
+			LogAction("APPLY", applyFile, "FAILED")
+			log.Fatal("⚠️  Apply finished with errors, see above.")
+		}
+		LogAction("APPLY", applyFile, "SUCCESS")
+		fmt.Println("\n✅ Host converged to manifest.")
+	},
+}
+
+// LoadManifest reads and validates a tenants manifest
+func LoadManifest(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest %s: %v", path, err)
+	}
+
+	var m Manifest
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&m); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest %s: %v", path, err)
+	}
+
+	seen := map[string]bool{}
+	claimed := map[string]string{}
+	for i := range m.Tenants {
+		t := &m.Tenants[i]
+		if err := ValidateUsername(t.Name); err != nil {
+			return nil, fmt.Errorf("tenant #%d: %v", i+1, err)
+		}
+		if seen[t.Name] {
+			return nil, fmt.Errorf("tenant '%s' is declared more than once", t.Name)
+		}
+		seen[t.Name] = true
+
+		if len(t.Domains) == 0 {
+			t.Domains = []string{fmt.Sprintf("%s.localhost", t.Name)}
+		}
+		domains, err := normalizeDomains(t.Domains)
+		if err != nil {
+			return nil, fmt.Errorf("tenant '%s': %v", t.Name, err)
+		}
+		t.Domains = domains
+		for _, d := range t.Domains {
+			if other, ok := claimed[d]; ok {
+				return nil, fmt.Errorf("tenant '%s': domain '%s' is already declared by tenant '%s'", t.Name, d, other)
+			}
+			claimed[d] = t.Name
+		}
+		if t.Idle == "" {
+			t.Idle = "5min"
+		}
+		if t.App != nil {
+			if err := t.App.Validate(); err != nil {
+				return nil, fmt.Errorf("tenant '%s': %v", t.Name, err)
+			}
+		}
+		if t.Limits != nil {
+			if err := t.Limits.Validate(); err != nil {
+				return nil, fmt.Errorf("tenant '%s': %v", t.Name, err)
+			}
+		}
+		if err := ValidateHardening(t.Hardening); err != nil {
+			return nil, fmt.Errorf("tenant '%s': %v", t.Name, err)
+		}
+		if err := ValidateActivation(t.Activation); err != nil {
+			return nil, fmt.Errorf("tenant '%s': %v", t.Name, err)
+		}
+		if t.Database != nil {
+			if err := t.Database.Validate(); err != nil {
+				return nil, fmt.Errorf("tenant '%s': %v", t.Name, err)
+			}
+		}
+		if t.Proxy != nil {
+			if err := t.Proxy.Validate(); err != nil {
+				return nil, fmt.Errorf("tenant '%s': %v", t.Name, err)
+			}
+			// Same normalization (canonical header names) as the stored policy
+			proxy := (*ProxyPolicy)(nil).Merge(*t.Proxy)
+			t.Proxy = &proxy
+		}
+	}
+	return &m, nil
+}
+
+// observeTenant collects the actual state of a tenant from the host
+func observeTenant(spec TenantSpec) (ObservedTenant, error) {
+	obs := ObservedTenant{Units: map[string]string{}}
+
+	if u, err := user.Lookup(spec.Name); err == nil {
+		obs.UserExists = true
+		obs.Managed = checkManagedUser(u) == nil
+	}
+	var err error
+	if obs.RoleExists, err = roleExists(spec.Name); err != nil {
+		return obs, err
+	}
+	if obs.DatabaseExists, err = databaseExists(spec.Name); err != nil {
+		return obs, err
+	}
+	if obs.RoleExists {
+		if obs.DBLimitChanges, err = pendingDBLimits(spec.Name, spec.Database); err != nil {
+			return obs, err
+		}
+	}
+
+	if obs.UserExists {
+		config, err := tenantSystemdConfig(spec.Name, spec.Idle)
+		if err != nil {
+			return obs, err
+		}
+		// The manifest, not the inventory, defines the desired application, limits, hardening and activation
+		config.setApp(spec.App)
+		config.Limits = spec.Limits.Directives()
+		config.Hardening = hardeningDirectives(spec.Hardening, config.HomeDir)
+		config.Direct = false
+		if activationOrDefault(spec.Activation) == ActivationDirect {
+			if err := config.setDirect(spec.Idle); err != nil {
+				return obs, err
+			}
+		}
+		if obs.WantUnits, err = renderUnits(config); err != nil {
+			return obs, err
+		}
+		if obs.Units, err = readUnits(config.HomeDir); err != nil {
+			return obs, err
+		}
+	}
+
+	routeID := tenantRouteID(spec.Name)
+	raw, err := NewCaddyClient("").GetRouteJSON(routeID)
+	if err != nil {
+		return obs, fmt.Errorf("failed to contact Caddy API: %v (is Caddy running?)", err)
+	}
+	if raw != nil {
+		var route CaddyRoute
+		if err := json.Unmarshal(raw, &route); err != nil {
+			return obs, fmt.Errorf("failed to decode route %s: %v", routeID, err)
+		}
+		obs.RouteExists = true
+		obs.RouteHosts = route.Hosts()
+		// The manifest defines the route; a running maintenance mode and the upstream
+		// of setup-proxy --upstream (inventory) are kept
+		want := &TenantRecord{Name: spec.Name, Proxy: spec.Proxy}
+		if rec, err := GetTenant(spec.Name); err != nil {
+			return obs, err
+		} else if rec != nil {
+			want.Maintenance, want.OfflinePage, want.Upstream = rec.Maintenance, rec.OfflinePage, rec.Upstream
+		}
+		equal, err := configEqual(raw, tenantRoute(want, spec.Domains, tenantUpstream(want)))
+		if err != nil {
+			return obs, err
+		}
+		obs.RouteModified = !equal
+	}
+
+	return obs, nil
+}
+
+// diffTenant computes the actions needed to converge the observed state to the spec
+func diffTenant(spec TenantSpec, obs ObservedTenant) []ApplyAction {
+	action := func(component, op, reason string) ApplyAction {
+		return ApplyAction{Tenant: spec.Name, Component: component, Op: op, Reason: reason}
+	}
+
+	// A missing user means a brand-new tenant, everything else depends on it
+	if !obs.UserExists {
+		return []ApplyAction{
+			action(ComponentUser, OpCreate, "user missing"),
+			action(ComponentDatabase, OpCreate, "new tenant"),
+			action(ComponentSystemd, OpCreate, "new tenant"),
+			action(ComponentProxy, OpCreate, "new tenant"),
+		}
+	}
+
+	var actions []ApplyAction
+
+	if !obs.RoleExists || !obs.DatabaseExists {
+		actions = append(actions, action(ComponentDatabase, OpCreate, "role or database missing"))
+	} else if len(obs.DBLimitChanges) > 0 {
+		actions = append(actions, action(ComponentDatabase, OpUpdate, fmt.Sprintf("%d role setting(s) differ", len(obs.DBLimitChanges))))
+	}
+
+	missing, changed := 0, 0
+	for _, name := range unitFiles {
+		want, wanted := obs.WantUnits[name]
+		switch {
+		case !wanted:
+			if obs.Units[name] != "" {
+				changed++
+			}
+		case obs.Units[name] == "":
+			missing++
+		case obs.Units[name] != want:
+			changed++
+		}
+	}
+	if missing == len(obs.WantUnits) {
+		actions = append(actions, action(ComponentSystemd, OpCreate, "units missing"))
+	} else if missing > 0 || changed > 0 {
+		actions = append(actions, action(ComponentSystemd, OpUpdate, fmt.Sprintf("%d unit(s) missing, %d differ", missing, changed)))
+	}
+
+	if !obs.RouteExists {
+		actions = append(actions, action(ComponentProxy, OpCreate, "route missing"))
+	} else if !slices.Equal(obs.RouteHosts, spec.Domains) {
+		actions = append(actions, action(ComponentProxy, OpUpdate, fmt.Sprintf("hosts %v != %v", obs.RouteHosts, spec.Domains)))
+	} else if obs.RouteModified {
+		actions = append(actions, action(ComponentProxy, OpUpdate, "route or proxy policy differs"))
+	}
+
+	return actions
+}
+
+// applyTenant executes the planned actions of a single tenant
+func applyTenant(spec TenantSpec, actions []ApplyAction) error {
+	rec, err := GetTenant(spec.Name)
+	if err != nil {
+		return err
+	}
+	existed := rec != nil
+
+	// Units are rendered from the inventory, so store the desired settings first
+	if err := SetTenantApp(spec.Name, spec.App); err != nil {
+		return err
+	}
+	limits := ResourceLimits{}
+	if spec.Limits != nil {
+		limits = *spec.Limits
+	}
+	if err := SetTenantLimits(spec.Name, limits, true); err != nil {
+		return err
+	}
+	if err := SetTenantHardening(spec.Name, spec.Hardening); err != nil {
+		return err
+	}
+	if err := SetTenantActivation(spec.Name, spec.Activation); err != nil {
+		return err
+	}
+	dbLimits := DatabaseLimits{}
+	if spec.Database != nil {
+		dbLimits = *spec.Database
+	}
+	if err := SetTenantDBLimits(spec.Name, dbLimits, true); err != nil {
+		return err
+	}
+	proxy := ProxyPolicy{}
+	if spec.Proxy != nil {
+		proxy = *spec.Proxy
+	}
+	if err := SetTenantProxyPolicy(spec.Name, proxy, true); err != nil {
+		return err
+	}
+
+	// New tenants are provisioned transactionally, like create-tenant
+	if actions[0].Component == ComponentUser {
+		results, err := RunSteps(tenantSteps(spec.Name, spec.Domains, spec.Idle))
+		printStepReport(results)
+		if err != nil {
+			if stateErr := recordFailedProvisioning(spec.Name, existed, results); stateErr != nil {
+				log.Printf("⚠️  Failed to update tenant inventory: %v", stateErr)
+			}
+			return fmt.Errorf("%v (%s)", err, rollbackSummary(results))
+		}
+		return nil
+	}
+
+	// Existing tenants: the setup functions are idempotent, re-run the ones that drifted
+	for _, a := range actions {
+		var err error
+		switch a.Component {
+		case ComponentDatabase:
+			err = SetupDatabase(spec.Name)
+		case ComponentSystemd:
+			err = SetupSystemd(spec.Name, spec.Idle)
+		case ComponentProxy:
+			err = SetupProxy(spec.Name, spec.Domains, "")
+		}
+		if err != nil {
+			return fmt.Errorf("%s %s: %v", a.Op, a.Component, err)
+		}
+	}
+	return nil
+}
+
+// pruneCandidates returns the managed tenants that are not declared in the manifest
+func pruneCandidates(m *Manifest) ([]string, error) {
+	st, err := LoadState()
+	if err != nil {
+		return nil, err
+	}
+
+	declared := map[string]bool{}
+	for _, t := range m.Tenants {
+		declared[t.Name] = true
+	}
+
+	var names []string
+	for _, name := range st.Names() {
+		if !declared[name] {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+func printApplyPlan(actions []ApplyAction) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "TENANT\tCOMPONENT\tACTION\tREASON")
+	fmt.Fprintln(w, "------\t---------\t------\t------")
+	for _, a := range actions {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", a.Tenant, a.Component, a.Op, a.Reason)
+	}
+	w.Flush()
+}
+
+func init() {
+	rootCmd.AddCommand(applyCmd)
+	applyCmd.Flags().StringVarP(&applyFile, "file", "f", "", "Path to the tenants manifest (YAML) [Required]")
+	applyCmd.Flags().BoolVar(&applyPrune, "prune", false, "Delete managed tenants that are not in the manifest")
+	_ = applyCmd.MarkFlagRequired("file")
+}
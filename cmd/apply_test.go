@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadManifest(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{"Valid", "tenants:\n  - name: alice\n    domains: [alice.example.com]\n    idle: 10s\n", false},
+		{"Defaults", "tenants:\n  - name: bob\n", false},
+		{"Invalid name", "tenants:\n  - name: Bob\n", true},
+		{"Duplicate", "tenants:\n  - name: bob\n  - name: bob\n", true},
+		{"Unknown field", "tenants:\n  - name: bob\n    domian: x\n", true},
+		{"Aliases", "tenants:\n  - name: alice\n    domains: [alice.example.com, www.alice.example.com]\n", false},
+		{"Shared domain", "tenants:\n  - name: alice\n    domains: [shop.example.com]\n  - name: bob\n    domains: [Shop.example.com]\n", true},
+		{"Invalid domain", "tenants:\n  - name: alice\n    domains: [\"alice example\"]\n", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "tenants.yaml")
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			m, err := LoadManifest(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadManifest() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && tt.name == "Defaults" {
+				spec := m.Tenants[0]
+				if spec.Idle != "5min" || len(spec.Domains) != 1 || spec.Domains[0] != "bob.localhost" {
+					t.Errorf("defaults not applied: %+v", spec)
+				}
+			}
+		})
+	}
+}
+
+func TestDiffTenant(t *testing.T) {
+	spec := TenantSpec{Name: "alice", Domains: []string{"alice.localhost"}, Idle: "5min"}
+	want := map[string]string{"rest-api.socket": "a", "rest-api-proxy.service": "b", "rest-api.service": "c", limitsDropIn: "d"}
+
+	converged := ObservedTenant{
+		UserExists: true, Managed: true, RoleExists: true, DatabaseExists: true,
+		Units: want, WantUnits: want,
+		RouteExists: true, RouteHosts: []string{"alice.localhost"},
+	}
+	if actions := diffTenant(spec, converged); len(actions) != 0 {
+		t.Errorf("diffTenant() on converged tenant = %v, want none", actions)
+	}
+
+	if actions := diffTenant(spec, ObservedTenant{}); len(actions) != 4 || actions[0].Component != ComponentUser {
+		t.Errorf("diffTenant() on missing tenant = %v, want full create", actions)
+	}
+
+	drifted := converged
+	drifted.Units = map[string]string{"rest-api.socket": "a", "rest-api-proxy.service": "edited", "rest-api.service": "c", limitsDropIn: "d"}
+	drifted.RouteHosts = []string{"old.localhost"}
+	drifted.DatabaseExists = false
+
+	actions := diffTenant(spec, drifted)
+	got := map[string]string{}
+	for _, a := range actions {
+		got[a.Component] = a.Op
+	}
+	wantOps := map[string]string{ComponentDatabase: OpCreate, ComponentSystemd: OpUpdate, ComponentProxy: OpUpdate}
+	for c, op := range wantOps {
+		if got[c] != op {
+			t.Errorf("component %s op = %q, want %q", c, got[c], op)
+		}
+	}
+}
@@ -0,0 +1,609 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// Default directory of the backup archives and the catalogue
+const defaultBackupDir = "/var/backups/pilot"
+
+// Members of a backup archive
+const (
+	backupDatabaseFile = "database.dump" // pg_dump --format=custom
+	backupHomeFile     = "home.tar.gz"   // the tenant's home directory
+)
+
+// Format of the timestamp in backup IDs
+const backupTimeFormat = "20060102T150405Z"
+
+var (
+	backupDir     string
+	backupName    string
+	backupKeep    int
+	backupMaxAge  string
+	restoreName   string
+	restoreFrom   string
+	restoreForce  bool
+	backupsTenant string
+)
+
+// BackupEntry is a single backup archive in the catalogue
+type BackupEntry struct {
+	ID        string    `json:"id"` // <tenant>-<timestamp>
+	Tenant    string    `json:"tenant"`
+	CreatedAt time.Time `json:"created_at"`
+	File      string    `json:"file"`
+	Size      int64     `json:"size"`
+	SHA256    string    `json:"sha256"`
+	Database  bool      `json:"database"`
+	Home      bool      `json:"home"`
+}
+
+// BackupCatalog lists every backup archive in a backup directory
+type BackupCatalog struct {
+	Backups []*BackupEntry `json:"backups"`
+}
+
+func catalogPath(dir string) string {
+	return filepath.Join(dir, "catalog.json")
+}
+
+// loadCatalog reads the catalogue of a backup directory. A missing file yields an empty catalogue.
+func loadCatalog(dir string) (*BackupCatalog, error) {
+	c := &BackupCatalog{}
+	data, err := os.ReadFile(catalogPath(dir))
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup catalogue: %v", err)
+	}
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, fmt.Errorf("failed to parse backup catalogue %s: %v", catalogPath(dir), err)
+	}
+	return c, nil
+}
+
+// save atomically writes the catalogue
+func (c *BackupCatalog) save(dir string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := catalogPath(dir) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write backup catalogue: %v", err)
+	}
+	if err := os.Rename(tmp, catalogPath(dir)); err != nil {
+		return fmt.Errorf("failed to replace backup catalogue: %v", err)
+	}
+	return nil
+}
+
+// withCatalogLock serializes read-modify-write cycles of the catalogue.
+// In dry-run mode fn runs against the current catalogue, which is not written back.
+func withCatalogLock(dir string, fn func(c *BackupCatalog) error) error {
+	if dryRun {
+		c, err := loadCatalog(dir)
+		if err != nil {
+			return err
+		}
+		return fn(c)
+	}
+
+	unlock, err := lockFile(catalogPath(dir) + ".lock")
+	if err != nil {
+		return fmt.Errorf("failed to lock backup catalogue: %v", err)
+	}
+	defer unlock()
+
+	c, err := loadCatalog(dir)
+	if err != nil {
+		return err
+	}
+	if err := fn(c); err != nil {
+		return err
+	}
+	return c.save(dir)
+}
+
+// forTenant returns the backups of a tenant, newest first
+func (c *BackupCatalog) forTenant(name string) []*BackupEntry {
+	var entries []*BackupEntry
+	for _, e := range c.Backups {
+		if name == "" || e.Tenant == name {
+			entries = append(entries, e)
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].CreatedAt.After(entries[j].CreatedAt)
+	})
+	return entries
+}
+
+// find returns the backup with the given ID, or nil
+func (c *BackupCatalog) find(id string) *BackupEntry {
+	for _, e := range c.Backups {
+		if e.ID == id {
+			return e
+		}
+	}
+	return nil
+}
+
+// remove drops entries from the catalogue
+func (c *BackupCatalog) remove(drop []*BackupEntry) {
+	kept := c.Backups[:0]
+	for _, e := range c.Backups {
+		if !containsEntry(drop, e) {
+			kept = append(kept, e)
+		}
+	}
+	c.Backups = kept
+}
+
+func containsEntry(entries []*BackupEntry, e *BackupEntry) bool {
+	for _, x := range entries {
+		if x == e {
+			return true
+		}
+	}
+	return false
+}
+
+// expiredBackups applies the retention policy to the backups of one tenant (newest first):
+// everything beyond the newest keep backups and everything older than maxAge expires.
+// A zero keep or maxAge disables that rule. The newest backup never expires.
+func expiredBackups(entries []*BackupEntry, keep int, maxAge time.Duration, now time.Time) []*BackupEntry {
+	var expired []*BackupEntry
+	for i, e := range entries {
+		if i == 0 {
+			continue
+		}
+		if (keep > 0 && i >= keep) || (maxAge > 0 && now.Sub(e.CreatedAt) > maxAge) {
+			expired = append(expired, e)
+		}
+	}
+	return expired
+}
+
+// fileSHA256 returns the hex encoded SHA-256 checksum of a file
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// workDir creates a temporary directory for the members of an archive.
+// In dry-run mode nothing is created and a placeholder path is returned.
+func workDir(parent, prefix string) (string, func(), error) {
+	if dryRun {
+		return filepath.Join(parent, prefix+"<tmp>"), func() {}, nil
+	}
+	dir, err := os.MkdirTemp(parent, prefix)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create temporary directory: %v", err)
+	}
+	return dir, func() { os.RemoveAll(dir) }, nil
+}
+
+var backupCmd = &cobra.Command{
+	Use:   "backup",
+	Short: "Backs up a tenant's database and home directory",
+	Long: `Creates a backup archive of a tenant in <dir>/<tenant>/<tenant>-<timestamp>.tar:
+  - database.dump: pg_dump of the tenant's database (custom format)
+  - home.tar.gz:   the tenant's home directory (units, data, application)
+
+The archive is added to the backup catalogue (<dir>/catalog.json). Afterwards the
+retention policy is applied to the tenant's backups: only the newest --keep backups
+are kept, and backups older than --max-age are deleted. The newest backup is
+never deleted.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		var maxAge time.Duration
+		if backupMaxAge != "" {
+			var err error
+			if maxAge, err = parseTimeSpan(backupMaxAge); err != nil {
+				log.Fatalf("❌ Invalid --max-age: %v", err)
+			}
+		}
+
+		LogAction("BACKUP", backupName, "STARTED")
+		entry, err := BackupTenant(backupName, backupDir, backupKeep, maxAge)
+		if err != nil {
+			LogAction("BACKUP", backupName, "FAILED")
+			log.Fatalf("❌ Error: %v", err)
+		}
+		LogAction("BACKUP", backupName, "SUCCESS")
+		fmt.Printf("✅ Backup '%s' created: %s\n", entry.ID, entry.File)
+	},
+}
+
+// BackupTenant dumps a tenant's database and archives its home directory
+// into a single archive, records it in the catalogue and applies the retention policy
+func BackupTenant(name, dir string, keep int, maxAge time.Duration) (*BackupEntry, error) {
+	if err := ValidateUsername(name); err != nil {
+		return nil, fmt.Errorf("security check failed: %v", err)
+	}
+	rec, err := GetTenant(name)
+	if err != nil {
+		return nil, err
+	}
+	if rec == nil {
+		return nil, fmt.Errorf("tenant '%s' is not managed by pilot", name)
+	}
+	u, err := lookupTenantUser(name)
+	if err != nil {
+		return nil, fmt.Errorf("could not find user %s: %v", name, err)
+	}
+
+	now := time.Now().UTC()
+	entry := &BackupEntry{
+		ID:        name + "-" + now.Format(backupTimeFormat),
+		Tenant:    name,
+		CreatedAt: now,
+	}
+	tenantDir := filepath.Join(dir, name)
+	entry.File = filepath.Join(tenantDir, entry.ID+".tar")
+
+	fmt.Printf("💾 Backing up tenant '%s'...\n", name)
+
+	if err := makeDir(dir, 0700); err != nil {
+		return nil, err
+	}
+	if err := makeDir(tenantDir, 0700); err != nil {
+		return nil, err
+	}
+	work, cleanup, err := workDir(tenantDir, ".backup-")
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	var members []string
+
+	// 1. Database
+	exists, err := databaseExists(name)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		fmt.Printf("   🐘 Dumping database '%s'...\n", name)
+		out, err := runCommandToFile(filepath.Join(work, backupDatabaseFile),
+			"runuser", "-u", postgresSuperuser, "--", "pg_dump", "--format=custom", "--dbname="+name)
+		if err != nil {
+			return nil, fmt.Errorf("pg_dump failed: %v (%s)", err, strings.TrimSpace(string(out)))
+		}
+		members = append(members, backupDatabaseFile)
+		entry.Database = true
+	} else {
+		fmt.Printf("   ℹ️  Database '%s' does not exist, skipping.\n", name)
+	}
+
+	// 2. Home directory
+	if _, err := os.Stat(u.HomeDir); err == nil || dryRun {
+		fmt.Printf("   📁 Archiving %s...\n", u.HomeDir)
+		out, err := runCommand("tar", "-czf", filepath.Join(work, backupHomeFile), "-C", u.HomeDir, ".")
+		if err != nil {
+			return nil, fmt.Errorf("failed to archive home directory: %v (%s)", err, strings.TrimSpace(string(out)))
+		}
+		members = append(members, backupHomeFile)
+		entry.Home = true
+	} else {
+		fmt.Printf("   ℹ️  Home directory %s does not exist, skipping.\n", u.HomeDir)
+	}
+
+	if len(members) == 0 {
+		return nil, fmt.Errorf("nothing to back up for tenant '%s'", name)
+	}
+
+	// 3. Bundle both into one archive. An archive that does not make it into the
+	// catalogue (partial tar, failed checksum) is removed again.
+	catalogued := false
+	defer func() {
+		if !catalogued && !dryRun {
+			os.Remove(entry.File)
+		}
+	}()
+	out, err := runCommand("tar", append([]string{"-cf", entry.File, "-C", work}, members...)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create backup archive: %v (%s)", err, strings.TrimSpace(string(out)))
+	}
+	if !dryRun {
+		if err := os.Chmod(entry.File, 0600); err != nil {
+			return nil, fmt.Errorf("failed to chmod backup archive: %v", err)
+		}
+		info, err := os.Stat(entry.File)
+		if err != nil {
+			return nil, err
+		}
+		entry.Size = info.Size()
+		if entry.SHA256, err = fileSHA256(entry.File); err != nil {
+			return nil, fmt.Errorf("failed to checksum backup archive: %v", err)
+		}
+	}
+
+	// 4. Catalogue & Retention
+	err = withCatalogLock(dir, func(c *BackupCatalog) error {
+		c.Backups = append(c.Backups, entry)
+		expired := expiredBackups(c.forTenant(name), keep, maxAge, now)
+		for _, e := range expired {
+			fmt.Printf("   🗑️  Removing expired backup '%s'...\n", e.ID)
+			if err := removeFile(e.File); err != nil {
+				return err
+			}
+		}
+		c.remove(expired)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	catalogued = true
+	return entry, nil
+}
+
+var restoreCmd = &cobra.Command{
+	Use:   "restore",
+	Short: "Restores a tenant from a backup",
+	Long: `Restores a tenant's database and home directory from a backup archive.
+
+--from is a backup ID from the catalogue (see 'pilot backups') or the path of an
+archive; without it the newest backup of the tenant is used. A backup of another
+tenant is rejected, and so is an archive that is not in the catalogue unless
+--force is given. Other tenants are not touched:
+1. Stops the tenant's socket and services.
+2. Creates the role and database if they are missing, then restores the dump
+   with pg_restore --clean (objects not in the dump are kept).
+3. Extracts the home directory archive over the tenant's home directory.
+4. Starts the socket again.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		LogAction("RESTORE", restoreName, "STARTED")
+		if err := RestoreTenant(restoreName, backupDir, restoreFrom, restoreForce); err != nil {
+			LogAction("RESTORE", restoreName, "FAILED")
+			log.Fatalf("❌ Error: %v", err)
+		}
+		LogAction("RESTORE", restoreName, "SUCCESS")
+		fmt.Printf("✅ Tenant '%s' restored.\n", restoreName)
+	},
+}
+
+// resolveBackup finds the archive to restore: a catalogue ID, a file path or,
+// if from is empty, the newest backup of the tenant. The entry is nil for
+// archives that are not in the catalogue. Catalogued backups must belong to the
+// tenant; archives that are not in the catalogue carry no owner and need force.
+func resolveBackup(name, dir, from string, force bool) (string, *BackupEntry, error) {
+	c, err := loadCatalog(dir)
+	if err != nil {
+		return "", nil, err
+	}
+	if from == "" {
+		entries := c.forTenant(name)
+		if len(entries) == 0 {
+			return "", nil, fmt.Errorf("no backups of tenant '%s' in %s", name, dir)
+		}
+		return entries[0].File, entries[0], nil
+	}
+	if e := c.find(from); e != nil {
+		if e.Tenant != name {
+			return "", nil, fmt.Errorf("backup '%s' belongs to tenant '%s', not '%s'", from, e.Tenant, name)
+		}
+		return e.File, e, nil
+	}
+	if _, err := os.Stat(from); err != nil {
+		return "", nil, fmt.Errorf("backup '%s' is neither in the catalogue nor a file", from)
+	}
+	path, err := filepath.Abs(from)
+	if err != nil {
+		return "", nil, err
+	}
+	for _, e := range c.Backups {
+		if filepath.Clean(e.File) != path {
+			continue
+		}
+		if e.Tenant != name {
+			return "", nil, fmt.Errorf("backup '%s' belongs to tenant '%s', not '%s'", from, e.Tenant, name)
+		}
+		return from, e, nil
+	}
+	if !force {
+		return "", nil, fmt.Errorf("backup '%s' is not in the catalogue, so its tenant is unknown (use --force to restore it into '%s' anyway)", from, name)
+	}
+	return from, nil, nil
+}
+
+// archiveMembers lists the files of a backup archive
+func archiveMembers(path string) (map[string]bool, error) {
+	out, err := exec.Command("tar", "-tf", path).Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup archive %s: %v", path, err)
+	}
+	members := map[string]bool{}
+	for _, line := range strings.Split(string(out), "\n") {
+		if line = strings.TrimPrefix(strings.TrimSpace(line), "./"); line != "" {
+			members[line] = true
+		}
+	}
+	return members, nil
+}
+
+// RestoreTenant restores a tenant's database and home directory from a backup archive
+func RestoreTenant(name, dir, from string, force bool) (err error) {
+	if err := ValidateUsername(name); err != nil {
+		return fmt.Errorf("security check failed: %v", err)
+	}
+	rec, err := GetTenant(name)
+	if err != nil {
+		return err
+	}
+	if rec == nil {
+		return fmt.Errorf("tenant '%s' is not managed by pilot", name)
+	}
+	u, err := lookupTenantUser(name)
+	if err != nil {
+		return fmt.Errorf("could not find user %s: %v", name, err)
+	}
+
+	archive, entry, err := resolveBackup(name, dir, from, force)
+	if err != nil {
+		return err
+	}
+	if entry != nil && entry.SHA256 != "" {
+		sum, err := fileSHA256(archive)
+		if err != nil {
+			return fmt.Errorf("failed to read backup archive: %v", err)
+		}
+		if sum != entry.SHA256 {
+			return fmt.Errorf("checksum mismatch for %s, the archive is damaged", archive)
+		}
+	}
+	members, err := archiveMembers(archive)
+	if err != nil {
+		return err
+	}
+	if !members[backupDatabaseFile] && !members[backupHomeFile] {
+		return fmt.Errorf("%s is not a pilot backup archive", archive)
+	}
+
+	fmt.Printf("♻️  Restoring tenant '%s' from %s...\n", name, archive)
+
+	work, cleanup, err := workDir(os.TempDir(), "pilot-restore-")
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	if out, err := runCommand("tar", "-xf", archive, "-C", work); err != nil {
+		return fmt.Errorf("failed to extract backup archive: %v (%s)", err, strings.TrimSpace(string(out)))
+	}
+
+	// 1. Stop the tenant, so nothing writes while the data is replaced
+	manager, err := ConnectUserManager(name)
+	switch {
+	case errors.Is(err, ErrManagerNotRunning):
+		fmt.Printf("   ℹ️  User manager for '%s' is not running, skipping systemctl.\n", name)
+	case err != nil:
+		return err
+	default:
+		defer manager.Close()
+		fmt.Printf("   ⏸️  Stopping units of '%s'...\n", name)
+		if err := manager.Stop("rest-api.socket", "rest-api-proxy.service", "rest-api.service"); err != nil {
+			return err
+		}
+		// A failed restore must not leave the tenant offline
+		defer func() {
+			if err == nil {
+				return
+			}
+			fmt.Printf("   ▶️  Restore failed, starting the socket of '%s' again...\n", name)
+			if startErr := manager.Start("rest-api.socket"); startErr != nil {
+				log.Printf("⚠️  Failed to start rest-api.socket, tenant '%s' stays offline: %v", name, startErr)
+			}
+		}()
+	}
+
+	// 2. Database
+	if members[backupDatabaseFile] {
+		if err := SetupDatabase(name); err != nil {
+			return err
+		}
+		fmt.Printf("   🐘 Restoring database '%s'...\n", name)
+		out, err := runCommandFromFile(filepath.Join(work, backupDatabaseFile),
+			"runuser", "-u", postgresSuperuser, "--", "pg_restore", "--clean", "--if-exists", "--single-transaction", "--exit-on-error", "--dbname="+name)
+		if err != nil {
+			return fmt.Errorf("pg_restore failed: %v (%s)", err, strings.TrimSpace(string(out)))
+		}
+	}
+
+	// 3. Home directory (extracted as root, so ownership is restored by user name)
+	if members[backupHomeFile] {
+		fmt.Printf("   📁 Restoring %s...\n", u.HomeDir)
+		if out, err := runCommand("tar", "-xzf", filepath.Join(work, backupHomeFile), "-C", u.HomeDir); err != nil {
+			return fmt.Errorf("failed to restore home directory: %v (%s)", err, strings.TrimSpace(string(out)))
+		}
+	}
+
+	// 4. Start the socket again
+	if manager != nil {
+		if err := manager.DaemonReload(); err != nil {
+			return err
+		}
+		if err := manager.Start("rest-api.socket"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var backupsCmd = &cobra.Command{
+	Use:   "backups",
+	Short: "Lists the backup catalogue",
+	Run: func(cmd *cobra.Command, args []string) {
+		c, err := loadCatalog(backupDir)
+		if err != nil {
+			log.Fatalf("❌ Error: %v", err)
+		}
+		entries := c.forTenant(backupsTenant)
+		if len(entries) == 0 {
+			fmt.Println("No backups found.")
+			return
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+		fmt.Fprintln(w, "ID\tTENANT\tCREATED\tSIZE\tCONTENTS\tFILE")
+		fmt.Fprintln(w, "--\t------\t-------\t----\t--------\t----")
+		for _, e := range entries {
+			var contents []string
+			if e.Database {
+				contents = append(contents, "database")
+			}
+			if e.Home {
+				contents = append(contents, "home")
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", e.ID, e.Tenant, e.CreatedAt.Local().Format("2006-01-02 15:04"),
+				formatBytes(e.Size), strings.Join(contents, "+"), e.File)
+		}
+		w.Flush()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(backupCmd)
+	backupCmd.Flags().StringVarP(&backupName, "name", "n", "", "Tenant Name")
+	backupCmd.Flags().StringVar(&backupDir, "dir", defaultBackupDir, "Backup directory")
+	backupCmd.Flags().IntVar(&backupKeep, "keep", 7, "Number of backups to keep per tenant (0 = unlimited)")
+	backupCmd.Flags().StringVar(&backupMaxAge, "max-age", "", "Delete backups older than this (e.g. 30d)")
+	_ = backupCmd.MarkFlagRequired("name")
+
+	rootCmd.AddCommand(restoreCmd)
+	restoreCmd.Flags().StringVarP(&restoreName, "name", "n", "", "Tenant Name")
+	restoreCmd.Flags().StringVar(&restoreFrom, "from", "", "Backup ID or archive path (default: newest backup)")
+	restoreCmd.Flags().BoolVar(&restoreForce, "force", false, "Restore an archive that is not in the catalogue")
+	restoreCmd.Flags().StringVar(&backupDir, "dir", defaultBackupDir, "Backup directory")
+	_ = restoreCmd.MarkFlagRequired("name")
+
+	rootCmd.AddCommand(backupsCmd)
+	backupsCmd.Flags().StringVarP(&backupsTenant, "name", "n", "", "Only list backups of a single tenant")
+	backupsCmd.Flags().StringVar(&backupDir, "dir", defaultBackupDir, "Backup directory")
+}
@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestExpiredBackups(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	var entries []*BackupEntry
+	for i := 0; i < 5; i++ {
+		entries = append(entries, &BackupEntry{ID: string(rune('a' + i)), CreatedAt: now.Add(-time.Duration(i) * 24 * time.Hour)})
+	}
+
+	ids := func(es []*BackupEntry) string {
+		s := ""
+		for _, e := range es {
+			s += e.ID
+		}
+		return s
+	}
+
+	tests := []struct {
+		keep   int
+		maxAge time.Duration
+		want   string
+	}{
+		{0, 0, ""},
+		{3, 0, "de"},
+		{0, 36 * time.Hour, "cde"},
+		{4, 72*time.Hour - time.Minute, "de"},
+		{1, 0, "bcde"},
+	}
+	for _, tt := range tests {
+		if got := ids(expiredBackups(entries, tt.keep, tt.maxAge, now)); got != tt.want {
+			t.Errorf("expiredBackups(keep=%d, maxAge=%v) = %q, want %q", tt.keep, tt.maxAge, got, tt.want)
+		}
+	}
+
+	// The newest backup survives even if it is older than maxAge
+	if got := expiredBackups(entries[4:], 0, time.Hour, now); len(got) != 0 {
+		t.Errorf("newest backup expired: %v", got)
+	}
+}
+
+func TestCatalogRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now().UTC()
+
+	err := withCatalogLock(dir, func(c *BackupCatalog) error {
+		c.Backups = append(c.Backups,
+			&BackupEntry{ID: "alice-1", Tenant: "alice", CreatedAt: now.Add(-time.Hour), File: "/b/alice-1.tar"},
+			&BackupEntry{ID: "bob-1", Tenant: "bob", CreatedAt: now, File: "/b/bob-1.tar"},
+			&BackupEntry{ID: "alice-2", Tenant: "alice", CreatedAt: now, File: "/b/alice-2.tar"},
+		)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := loadCatalog(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice := c.forTenant("alice")
+	if len(alice) != 2 || alice[0].ID != "alice-2" {
+		t.Fatalf("forTenant(alice) = %v, want newest first", alice)
+	}
+
+	file, entry, err := resolveBackup("alice", dir, "", false)
+	if err != nil || entry == nil || file != "/b/alice-2.tar" {
+		t.Errorf("resolveBackup(latest) = %q, %v, %v", file, entry, err)
+	}
+	if _, _, err := resolveBackup("alice", dir, "bob-1", false); err == nil {
+		t.Error("restoring another tenant's backup should fail")
+	}
+
+	// Archive paths get the same owner check; unknown archives need force
+	archives := t.TempDir()
+	for _, f := range []string{"bob-1.tar", "alice-2.tar", "foreign.tar"} {
+		if err := os.WriteFile(filepath.Join(archives, f), nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = withCatalogLock(dir, func(c *BackupCatalog) error {
+		c.Backups = append(c.Backups,
+			&BackupEntry{ID: "bob-2", Tenant: "bob", CreatedAt: now, File: filepath.Join(archives, "bob-1.tar")},
+			&BackupEntry{ID: "alice-3", Tenant: "alice", CreatedAt: now, File: filepath.Join(archives, "alice-2.tar")},
+		)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := resolveBackup("alice", dir, filepath.Join(archives, "bob-1.tar"), true); err == nil {
+		t.Error("restoring another tenant's archive by path should fail, even with force")
+	}
+	if _, entry, err := resolveBackup("alice", dir, filepath.Join(archives, "alice-2.tar"), false); err != nil || entry == nil || entry.ID != "alice-3" {
+		t.Errorf("resolveBackup(own path) = %v, %v", entry, err)
+	}
+	if _, _, err := resolveBackup("alice", dir, filepath.Join(archives, "foreign.tar"), false); err == nil {
+		t.Error("an archive that is not in the catalogue needs --force")
+	}
+	if file, entry, err := resolveBackup("alice", dir, filepath.Join(archives, "foreign.tar"), true); err != nil || entry != nil || file == "" {
+		t.Errorf("resolveBackup(foreign, force) = %q, %v, %v", file, entry, err)
+	}
+
+	c.remove(alice[1:])
+	if c.find("alice-1") != nil || c.find("bob-1") == nil {
+		t.Errorf("remove dropped the wrong entries: %v", c.Backups)
+	}
+}
@@ -2,28 +2,87 @@ package cmd
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"slices"
 	"strings"
 )
 
+// Defaults of the Caddy settings
+const (
+	defaultCaddyAdmin  = "localhost:2019"
+	defaultCaddyServer = "srv0"
+)
+
+var defaultCaddyListen = []string{":443"}
+
+// How often a conditional write is retried after a concurrent config change
+const configRetries = 3
+
+// ErrConfigConflict is returned when the Caddy config changed between reading it
+// and a write that was conditional on it (412 Precondition Failed)
+var ErrConfigConflict = errors.New("Caddy config was changed concurrently")
+
+// Caddy settings, set by the global --caddy-admin, --caddy-server and --caddy-listen
+// flags, which default to PILOT_CADDY_ADMIN, PILOT_CADDY_SERVER and PILOT_CADDY_LISTEN
+var (
+	caddyAdmin  string
+	caddyServer string
+	caddyListen []string
+)
+
 // CaddyClient handles interactions with the Caddy Admin API
 type CaddyClient struct {
 	BaseURL string
 	Client  *http.Client
+	Server  string   // name of the HTTP server the tenant routes live in
+	Listen  []string // addresses that server listens on
 }
 
-// NewCaddyClient creates a new client (defaulting to localhost:2019)
-func NewCaddyClient(baseURL string) *CaddyClient {
-	if baseURL == "" {
-		baseURL = "http://localhost:2019"
+// NewCaddyClient creates a new client for an admin address (defaulting to --caddy-admin).
+// Besides host:port and http(s) URLs, the admin address may be a unix socket in
+// Caddy's network address syntax (unix//run/caddy/admin.sock).
+func NewCaddyClient(admin string) *CaddyClient {
+	if admin == "" {
+		admin = caddyAdmin
+	}
+	if admin == "" {
+		admin = defaultCaddyAdmin
 	}
-	return &CaddyClient{
-		BaseURL: baseURL,
-		Client:  &http.Client{},
+	c := &CaddyClient{
+		Client: &http.Client{},
+		Server: caddyServer,
+		Listen: caddyListen,
 	}
+	if c.Server == "" {
+		c.Server = defaultCaddyServer
+	}
+	if len(c.Listen) == 0 {
+		c.Listen = defaultCaddyListen
+	}
+
+	switch {
+	case strings.HasPrefix(admin, "unix/"):
+		// Over a unix socket Caddy accepts the Host 127.0.0.1 (or none)
+		socket := strings.TrimPrefix(admin, "unix/")
+		c.BaseURL = "http://127.0.0.1"
+		c.Client.Transport = &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socket)
+			},
+		}
+	case strings.HasPrefix(admin, "http://"), strings.HasPrefix(admin, "https://"):
+		c.BaseURL = strings.TrimSuffix(admin, "/")
+	default:
+		c.BaseURL = "http://" + strings.TrimPrefix(admin, "tcp/")
+	}
+	return c
 }
 
 // RouteExists checks if a route ID exists
@@ -43,62 +102,366 @@ func (c *CaddyClient) RouteExists(id string) (bool, error) {
 	return false, fmt.Errorf("unexpected status %d", resp.StatusCode)
 }
 
-// AddRoute adds a new route to srv0
-func (c *CaddyClient) AddRoute(id, domain, upstream string) error {
-	route := buildRoute(id, domain, upstream)
+// GetRoute fetches a route by ID. It returns nil if the route does not exist.
+func (c *CaddyClient) GetRoute(id string) (*CaddyRoute, error) {
+	raw, err := c.GetRouteJSON(id)
+	if err != nil || raw == nil {
+		return nil, err
+	}
+
+	var route CaddyRoute
+	if err := json.Unmarshal(raw, &route); err != nil {
+		return nil, fmt.Errorf("failed to decode route %s: %v", id, err)
+	}
+	return &route, nil
+}
+
+// GetRouteJSON fetches the raw JSON of a route by ID, including fields CaddyRoute
+// does not model. It returns nil if the route does not exist.
+func (c *CaddyClient) GetRouteJSON(id string) (json.RawMessage, error) {
+	return c.getJSON(fmt.Sprintf("%s/id/%s", c.BaseURL, id))
+}
+
+// GetConfigJSON fetches the raw JSON at a config path (e.g. "apps/tls").
+// It returns nil if nothing is configured there.
+func (c *CaddyClient) GetConfigJSON(path string) (json.RawMessage, error) {
+	return c.getJSON(fmt.Sprintf("%s/config/%s", c.BaseURL, path))
+}
+
+// EnsurePath creates a config path (e.g. apps, http, servers, srv0) unless it exists.
+// Only the first missing key is written, holding empty objects for the keys below it
+// and leaf at the end; existing config is never replaced. The write is conditional on
+// the ETag of the config it was derived from and retried after concurrent changes.
+// It reports whether anything was created.
+func (c *CaddyClient) EnsurePath(leaf interface{}, segments ...string) (bool, error) {
+	created := false
+	err := retryOnConflict(func() error {
+		raw, etag, err := c.getJSONTag(c.BaseURL + "/config/")
+		if err != nil {
+			return err
+		}
+		var config interface{}
+		if raw != nil {
+			if err := json.Unmarshal(raw, &config); err != nil {
+				return fmt.Errorf("failed to decode Caddy config: %v", err)
+			}
+		}
+
+		missing := missingPath(config, segments)
+		if missing < 0 {
+			return nil
+		}
+		value := leaf
+		for i := len(segments) - 1; i > missing; i-- {
+			value = map[string]interface{}{segments[i]: value}
+		}
+
+		url := fmt.Sprintf("%s/config/%s", c.BaseURL, strings.Join(segments[:missing+1], "/"))
+		if config == nil {
+			// An empty config has no object to add a key to, so the whole (new) config is loaded
+			url, value = c.BaseURL+"/config/", map[string]interface{}{segments[0]: value}
+		}
+		payload, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		if config == nil {
+			err = c.postRequest(url, payload, etag)
+		} else {
+			err = c.putRequest(url, payload, etag) // PUT only creates, it fails if the key exists
+		}
+		created = err == nil
+		return err
+	})
+	return created, err
+}
+
+// missingPath returns the index of the first path segment that is not configured, or -1
+func missingPath(config interface{}, segments []string) int {
+	current := config
+	for i, key := range segments {
+		obj, ok := current.(map[string]interface{})
+		if !ok || obj[key] == nil {
+			return i
+		}
+		current = obj[key]
+	}
+	return -1
+}
+
+// EnsureServer creates the HTTP server (listening on its HTTPS addresses) with an empty
+// route list, unless it exists. Other servers, apps and routes are left untouched.
+func (c *CaddyClient) EnsureServer() error {
+	created, err := c.EnsurePath(map[string]interface{}{
+		"listen": c.Listen,
+		"routes": []interface{}{},
+	}, "apps", "http", "servers", c.Server)
+	if err != nil || created {
+		return err
+	}
+	// An existing server may not have any routes yet
+	_, err = c.EnsurePath([]interface{}{}, "apps", "http", "servers", c.Server, "routes")
+	return err
+}
+
+// ListRoutes fetches all routes of the server in the order Caddy evaluates them.
+// A server without routes (or no such server, or no HTTP app at all) yields an empty list.
+func (c *CaddyClient) ListRoutes() ([]CaddyRoute, error) {
+	resp, err := c.Client.Get(c.routesURL())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if missing, err := pathMissing(resp); missing || err != nil {
+		return nil, err
+	}
+
+	var routes []CaddyRoute
+	if err := json.NewDecoder(resp.Body).Decode(&routes); err != nil {
+		return nil, fmt.Errorf("failed to decode routes: %v", err)
+	}
+	return routes, nil
+}
+
+// AddRoute adds a new route to the server
+func (c *CaddyClient) AddRoute(route CaddyRoute) error {
 	payload, err := json.Marshal(route)
 	if err != nil {
 		return err
 	}
 
-	url := fmt.Sprintf("%s/config/apps/http/servers/srv0/routes", c.BaseURL)
-	return c.postRequest(url, payload)
+	// Conditional on the route list it was checked against, so concurrent runs cannot both add it
+	return retryOnConflict(func() error {
+		raw, etag, err := c.getJSONTag(c.routesURL())
+		if err != nil {
+			return err
+		}
+		var routes []CaddyRoute
+		if raw != nil {
+			if err := json.Unmarshal(raw, &routes); err != nil {
+				return fmt.Errorf("failed to decode routes: %v", err)
+			}
+		}
+		for _, r := range routes {
+			if r.ID == route.ID {
+				return fmt.Errorf("route %s already exists", route.ID)
+			}
+		}
+		return c.postRequest(c.routesURL(), payload, etag)
+	})
 }
 
-// UpdateRoute updates an existing route by ID
-func (c *CaddyClient) UpdateRoute(id, domain, upstream string) error {
-	route := buildRoute(id, domain, upstream)
+// UpdateRoute replaces an existing route by its ID
+func (c *CaddyClient) UpdateRoute(route CaddyRoute) error {
 	payload, err := json.Marshal(route)
 	if err != nil {
 		return err
 	}
 
+	// PATCH replaces the route in place (PUT would insert a copy before it)
+	url := fmt.Sprintf("%s/id/%s", c.BaseURL, route.ID)
+	return retryOnConflict(func() error {
+		_, etag, err := c.getJSONTag(url)
+		if err != nil {
+			return err
+		}
+		return c.patchRequest(url, payload, etag)
+	})
+}
+
+// DeleteRoute removes a route by ID
+func (c *CaddyClient) DeleteRoute(id string) error {
 	url := fmt.Sprintf("%s/id/%s", c.BaseURL, id)
-	return c.putRequest(url, payload)
-}
-
-// InitServer ensures the basics (http app, srv0) exist
-func (c *CaddyClient) InitServer() error {
-	config := map[string]interface{}{
-		"apps": map[string]interface{}{
-			"http": map[string]interface{}{
-				"servers": map[string]interface{}{
-					"srv0": map[string]interface{}{
-						"listen": []string{":80"},
-						"routes": []interface{}{},
-					},
-				},
-			},
-		},
+	return c.deleteRequest(url)
+}
+
+// SetTLSPolicy creates or replaces a TLS automation policy by ID
+func (c *CaddyClient) SetTLSPolicy(policy CaddyTLSPolicy) error {
+	payload, err := json.Marshal(policy)
+	if err != nil {
+		return err
+	}
+	// The TLS app may not have any automation policies yet
+	return c.setByID(policy.ID, payload, "apps", "tls", "automation", "policies")
+}
+
+// SetErrorRoute creates or replaces a route of the server's error handling
+// (handle_errors) by ID
+func (c *CaddyClient) SetErrorRoute(route CaddyRoute) error {
+	payload, err := json.Marshal(route)
+	if err != nil {
+		return err
 	}
-	payload, _ := json.Marshal(config)
-	return c.postRequest(fmt.Sprintf("%s/config/", c.BaseURL), payload)
+	return c.setByID(route.ID, payload, "apps", "http", "servers", c.Server, "errors", "routes")
+}
+
+// setByID replaces the object with an @id, or appends it to the list at a config
+// path, which is created if missing
+func (c *CaddyClient) setByID(id string, payload []byte, list ...string) error {
+	if _, err := c.EnsurePath([]interface{}{}, list...); err != nil {
+		return err
+	}
+
+	idURL := fmt.Sprintf("%s/id/%s", c.BaseURL, id)
+	listURL := fmt.Sprintf("%s/config/%s", c.BaseURL, strings.Join(list, "/"))
+	return retryOnConflict(func() error {
+		raw, etag, err := c.getJSONTag(idURL)
+		if err != nil {
+			return err
+		}
+		if raw != nil {
+			return c.patchRequest(idURL, payload, etag)
+		}
+		if _, etag, err = c.getJSONTag(listURL); err != nil {
+			return err
+		}
+		return c.postRequest(listURL, payload, etag)
+	})
+}
+
+// EnableHTTPS makes the server listen on its HTTPS addresses, so Caddy's automatic
+// HTTPS obtains certificates for the route hosts and redirects HTTP to HTTPS
+func (c *CaddyClient) EnableHTTPS() error {
+	url := fmt.Sprintf("%s/config/apps/http/servers/%s/listen", c.BaseURL, c.Server)
+	return retryOnConflict(func() error {
+		raw, etag, err := c.getJSONTag(url)
+		if err != nil {
+			return err
+		}
+		var listen []string
+		if raw != nil {
+			if err := json.Unmarshal(raw, &listen); err != nil {
+				return fmt.Errorf("failed to decode listen addresses of %s: %v", c.Server, err)
+			}
+		}
+		merged := mergeListen(listen, c.Listen)
+		if slices.Equal(merged, listen) {
+			return nil
+		}
+		payload, _ := json.Marshal(merged)
+		if raw == nil {
+			return c.putRequest(url, payload, etag)
+		}
+		return c.patchRequest(url, payload, etag)
+	})
+}
+
+// mergeListen adds the wanted addresses to the ones a server listens on. Addresses on
+// the HTTP port are dropped unless they are wanted: Caddy does not redirect HTTP to HTTPS
+// for a server that listens on the HTTP port itself (e.g. :80 of the old InitServer).
+// Other existing addresses are kept.
+func mergeListen(have, want []string) []string {
+	var merged []string
+	for _, addr := range have {
+		if !isHTTPListen(addr) || slices.Contains(want, addr) {
+			merged = append(merged, addr)
+		}
+	}
+	for _, addr := range want {
+		if !slices.Contains(merged, addr) {
+			merged = append(merged, addr)
+		}
+	}
+	return merged
+}
+
+// isHTTPListen reports whether a listen address (e.g. ":80", "tcp/0.0.0.0:80") is on
+// Caddy's default HTTP port
+func isHTTPListen(addr string) bool {
+	_, port, err := net.SplitHostPort(strings.TrimPrefix(addr, "tcp/"))
+	return err == nil && port == "80"
+}
+
+// LocalCARoot fetches the PEM root certificate of Caddy's internal CA ("local")
+func (c *CaddyClient) LocalCARoot() (string, error) {
+	raw, err := c.getJSON(fmt.Sprintf("%s/pki/ca/local", c.BaseURL))
+	if err != nil || raw == nil {
+		return "", err
+	}
+	var ca struct {
+		Root string `json:"root_certificate"`
+	}
+	if err := json.Unmarshal(raw, &ca); err != nil {
+		return "", fmt.Errorf("failed to decode internal CA: %v", err)
+	}
+	return ca.Root, nil
 }
 
 // Helper methods
 
-func (c *CaddyClient) postRequest(url string, payload []byte) error {
-	resp, err := c.Client.Post(url, "application/json", bytes.NewBuffer(payload))
+// getJSON fetches a JSON document. It returns nil for 404 and for "null" (nothing configured).
+func (c *CaddyClient) getJSON(url string) (json.RawMessage, error) {
+	raw, _, err := c.getJSONTag(url)
+	return raw, err
+}
+
+// getJSONTag is getJSON that also returns the ETag of the config the document was read
+// from, for a conditional write (If-Match) based on it
+func (c *CaddyClient) getJSONTag(url string) (json.RawMessage, string, error) {
+	resp, err := c.Client.Get(url)
 	if err != nil {
-		return err
+		return nil, "", err
 	}
 	defer resp.Body.Close()
-	return checkResponse(resp)
+
+	if missing, err := pathMissing(resp); missing || err != nil {
+		return nil, "", err
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", err
+	}
+	etag := resp.Header.Get("Etag")
+	if trimmed := bytes.TrimSpace(body); len(trimmed) == 0 || string(trimmed) == "null" {
+		return nil, etag, nil
+	}
+	return body, etag, nil
+}
+
+func (c *CaddyClient) routesURL() string {
+	return fmt.Sprintf("%s/config/apps/http/servers/%s/routes", c.BaseURL, c.Server)
+}
+
+func (c *CaddyClient) postRequest(url string, payload []byte, etag string) error {
+	return c.request("POST", url, payload, etag)
+}
+
+func (c *CaddyClient) putRequest(url string, payload []byte, etag string) error {
+	return c.request("PUT", url, payload, etag)
+}
+
+func (c *CaddyClient) patchRequest(url string, payload []byte, etag string) error {
+	return c.request("PATCH", url, payload, etag)
+}
+
+func (c *CaddyClient) deleteRequest(url string) error {
+	return c.request("DELETE", url, nil, "")
 }
 
-func (c *CaddyClient) putRequest(url string, payload []byte) error {
-	req, _ := http.NewRequest("PUT", url, bytes.NewBuffer(payload))
-	req.Header.Set("Content-Type", "application/json")
+// request sends a change to the admin API. With an ETag (from getJSONTag) Caddy only
+// applies it if the config it was derived from is unchanged, otherwise it fails
+// with ErrConfigConflict.
+func (c *CaddyClient) request(method, url string, payload []byte, etag string) error {
+	if dryRun {
+		recordCaddyChange(method, url, payload)
+		return nil
+	}
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return err
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if etag != "" {
+		req.Header.Set("If-Match", etag)
+	}
 	resp, err := c.Client.Do(req)
 	if err != nil {
 		return err
@@ -107,9 +470,51 @@ func (c *CaddyClient) putRequest(url string, payload []byte) error {
 	return checkResponse(resp)
 }
 
+// retryOnConflict runs a read-modify-write cycle again if the config was changed
+// concurrently between reading and writing
+func retryOnConflict(fn func() error) error {
+	var err error
+	for i := 0; i < configRetries; i++ {
+		if err = fn(); !errors.Is(err, ErrConfigConflict) {
+			return err
+		}
+	}
+	return err
+}
+
+// recordCaddyChange records an admin API call with its pretty-printed payload
+func recordCaddyChange(method, url string, payload []byte) {
+	var pretty bytes.Buffer
+	if len(payload) > 0 && json.Indent(&pretty, payload, "", "  ") != nil {
+		pretty.Reset()
+		pretty.Write(payload)
+	}
+	recordChange("caddy", method+" "+url, pretty.String())
+}
+
+// pathMissing reports whether a GET failed because there is nothing at the path:
+// 404 for an unknown @id, or 400 "invalid traversal path" when a key above it does not
+// exist (e.g. apps/http on a fresh Caddy). Any other error response is returned.
+func pathMissing(resp *http.Response) (bool, error) {
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		return true, nil
+	case http.StatusBadRequest:
+		body, _ := io.ReadAll(resp.Body)
+		if strings.Contains(string(body), "invalid traversal path") {
+			return true, nil
+		}
+		return false, fmt.Errorf("api error: %s", string(body))
+	}
+	return false, checkResponse(resp)
+}
+
 func checkResponse(resp *http.Response) error {
 	if resp.StatusCode >= 300 {
 		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode == http.StatusPreconditionFailed {
+			return fmt.Errorf("%w: %s", ErrConfigConflict, strings.TrimSpace(string(body)))
+		}
 		return fmt.Errorf("api error: %s", string(body))
 	}
 	return nil
@@ -123,27 +528,77 @@ type CaddyRoute struct {
 	Handle []map[string]interface{} `json:"handle,omitempty"`
 }
 
+// CaddyTLSPolicy is an automation policy of Caddy's TLS app: which issuer
+// obtains the certificates for its subjects
+type CaddyTLSPolicy struct {
+	ID       string                   `json:"@id,omitempty"`
+	Subjects []string                 `json:"subjects,omitempty"`
+	Issuers  []map[string]interface{} `json:"issuers,omitempty"`
+}
+
 type CaddyMatch struct {
-	Host []string `json:"host,omitempty"`
+	Host       []string `json:"host,omitempty"`
+	Expression string   `json:"expression,omitempty"` // CEL, e.g. on {http.error.status_code}
 }
 
-func buildRoute(id, domain, upstream string) CaddyRoute {
+// Hosts returns the host names a route matches
+func (r CaddyRoute) Hosts() []string {
+	var hosts []string
+	for _, m := range r.Match {
+		hosts = append(hosts, m.Host...)
+	}
+	return hosts
+}
+
+// Upstreams returns the dial addresses of the route's reverse_proxy handlers
+func (r CaddyRoute) Upstreams() []string {
+	var dials []string
+	for _, h := range r.Handle {
+		if h["handler"] != "reverse_proxy" {
+			continue
+		}
+		switch upstreams := h["upstreams"].(type) {
+		case []map[string]string: // built by buildRoute
+			for _, u := range upstreams {
+				dials = append(dials, u["dial"])
+			}
+		case []interface{}: // decoded from the admin API
+			for _, u := range upstreams {
+				if m, ok := u.(map[string]interface{}); ok {
+					if dial, ok := m["dial"].(string); ok {
+						dials = append(dials, dial)
+					}
+				}
+			}
+		}
+	}
+	return dials
+}
+
+// buildRoute builds a route that sends every domain (apex, www, aliases) to one upstream,
+// behind the handlers of the tenant's proxy policy (if any)
+func buildRoute(id string, domains []string, upstream string, policy *ProxyPolicy) CaddyRoute {
 	// Determine dial address (unix vs tcp)
 	dial := upstream // Assume TCP (host:port) by default
 	if strings.HasPrefix(upstream, "/") || strings.HasPrefix(upstream, ".") {
 		dial = "unix/" + upstream
 	}
 
+	proxy := map[string]interface{}{
+		"handler": "reverse_proxy",
+		"upstreams": []map[string]string{{
+			"dial": dial,
+		}},
+	}
+	if transport := policy.Transport(); transport != nil {
+		proxy["transport"] = transport
+	}
+
 	return CaddyRoute{
 		ID: id,
 		Match: []CaddyMatch{{
-			Host: []string{domain},
-		}},
-		Handle: []map[string]interface{}{{
-			"handler": "reverse_proxy",
-			"upstreams": []map[string]string{{
-				"dial": dial,
-			}},
+			Host: domains,
 		}},
+		Handle: append(policy.Handlers(), proxy),
 	}
 }
@@ -0,0 +1,320 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestListRoutes(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/config/apps/http/servers/srv0/routes" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`[
+			{"@id": "tenant-alice", "match": [{"host": ["alice.localhost"]}],
+			 "handle": [{"handler": "reverse_proxy", "upstreams": [{"dial": "unix//run/pilot/alice.sock"}]}]},
+			{"match": [{"host": ["static.example.com"]}], "handle": [{"handler": "file_server"}]}
+		]`))
+	}))
+	defer srv.Close()
+
+	routes, err := NewCaddyClient(srv.URL).ListRoutes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(routes) != 2 {
+		t.Fatalf("got %d routes, want 2", len(routes))
+	}
+	if routes[0].ID != "tenant-alice" || !slices.Equal(routes[0].Hosts(), []string{"alice.localhost"}) {
+		t.Errorf("unexpected first route: %+v", routes[0])
+	}
+	if got := routes[0].Upstreams(); !slices.Equal(got, []string{"unix//run/pilot/alice.sock"}) {
+		t.Errorf("Upstreams() = %v", got)
+	}
+	if got := routes[1].Upstreams(); len(got) != 0 {
+		t.Errorf("file_server route has upstreams %v", got)
+	}
+}
+
+func TestBuiltRouteUpstreams(t *testing.T) {
+	r := buildRoute("tenant-bob", []string{"bob.localhost"}, "/run/pilot/bob.sock", nil)
+	if got := r.Upstreams(); !slices.Equal(got, []string{"unix//run/pilot/bob.sock"}) {
+		t.Errorf("Upstreams() = %v", got)
+	}
+	if name, ok := routeTenant(r.ID); !ok || name != "bob" {
+		t.Errorf("routeTenant(%q) = %q, %v", r.ID, name, ok)
+	}
+}
+
+func TestCaddyClientUnixSocket(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "admin.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var gotHost, gotPath string
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHost, gotPath = r.Host, r.URL.Path
+		w.Write([]byte("[]"))
+	}))
+	srv.Listener = l
+	srv.Start()
+	defer srv.Close()
+
+	caddyServer = "edge"
+	defer func() { caddyServer = "" }()
+
+	client := NewCaddyClient("unix/" + socket)
+	if _, err := client.ListRoutes(); err != nil {
+		t.Fatal(err)
+	}
+	if gotHost != "127.0.0.1" || gotPath != "/config/apps/http/servers/edge/routes" {
+		t.Errorf("request went to Host %q, path %q", gotHost, gotPath)
+	}
+}
+
+func TestNewCaddyClientAddress(t *testing.T) {
+	tests := map[string]string{
+		"":                        "http://localhost:2019",
+		"localhost:2020":          "http://localhost:2020",
+		"tcp/10.0.0.1:2019":       "http://10.0.0.1:2019",
+		"https://caddy.internal/": "https://caddy.internal",
+	}
+	for admin, want := range tests {
+		if got := NewCaddyClient(admin).BaseURL; got != want {
+			t.Errorf("NewCaddyClient(%q).BaseURL = %q, want %q", admin, got, want)
+		}
+	}
+}
+
+func TestMergeListen(t *testing.T) {
+	tests := []struct {
+		have, want, merged []string
+	}{
+		{[]string{":80"}, []string{":443"}, []string{":443"}},
+		{[]string{"tcp/0.0.0.0:80", ":8080"}, []string{":443"}, []string{":8080", ":443"}},
+		{[]string{":443", ":8443"}, []string{":443"}, []string{":443", ":8443"}},
+		{nil, []string{":443"}, []string{":443"}},
+		{[]string{"10.0.0.1:80"}, []string{"10.0.0.1:80", ":443"}, []string{"10.0.0.1:80", ":443"}},
+	}
+	for _, tt := range tests {
+		if got := mergeListen(tt.have, tt.want); !slices.Equal(got, tt.merged) {
+			t.Errorf("mergeListen(%v, %v) = %v, want %v", tt.have, tt.want, got, tt.merged)
+		}
+	}
+
+	for listen, want := range map[string]string{":443": "127.0.0.1:443", "0.0.0.0:8443": "127.0.0.1:8443", "10.0.0.1:443": "10.0.0.1:443"} {
+		if got := httpsProbeAddr([]string{listen}); got != want {
+			t.Errorf("httpsProbeAddr(%s) = %s, want %s", listen, got, want)
+		}
+	}
+}
+
+// fakeCaddy is an in-memory Caddy admin API for /config/ paths with ETag/If-Match
+// concurrency control. before is called before every write, to simulate concurrent writers.
+type fakeCaddy struct {
+	config interface{}
+	before func(f *fakeCaddy)
+	writes []string
+}
+
+func (f *fakeCaddy) hash() string {
+	raw, _ := json.Marshal(f.config)
+	return fmt.Sprintf("%x", sha256.Sum256(raw))
+}
+
+// findID returns the object with an @id and a function replacing it
+func findID(v interface{}, id string, replace func(interface{})) (interface{}, func(interface{})) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if v["@id"] == id {
+			return v, replace
+		}
+		for k, child := range v {
+			k := k
+			if found, set := findID(child, id, func(n interface{}) { v[k] = n }); found != nil {
+				return found, set
+			}
+		}
+	case []interface{}:
+		for i, child := range v {
+			i := i
+			if found, set := findID(child, id, func(n interface{}) { v[i] = n }); found != nil {
+				return found, set
+			}
+		}
+	}
+	return nil, nil
+}
+
+func (f *fakeCaddy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if id, ok := strings.CutPrefix(r.URL.Path, "/id/"); ok {
+		found, replace := findID(f.config, id, nil)
+		switch {
+		case found == nil:
+			http.NotFound(w, r)
+		case r.Method == "GET":
+			w.Header().Set("Etag", fmt.Sprintf(`"%s %s"`, r.URL.Path, f.hash()))
+			json.NewEncoder(w).Encode(found)
+		case r.Method == "PATCH":
+			f.writes = append(f.writes, r.Method+" "+r.URL.Path)
+			var value interface{}
+			json.NewDecoder(r.Body).Decode(&value)
+			replace(value)
+		default:
+			http.Error(w, "unsupported", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/config"), "/")
+	var segments []string
+	if path != "" {
+		segments = strings.Split(path, "/")
+	}
+
+	if r.Method == "GET" {
+		// Like Caddy: a missing last key is null, a missing key above it an error
+		value := f.config
+		for i, key := range segments {
+			obj, ok := value.(map[string]interface{})
+			if !ok {
+				http.Error(w, "invalid traversal path at: config/"+strings.Join(segments[:i], "/"), http.StatusBadRequest)
+				return
+			}
+			value = obj[key]
+		}
+		w.Header().Set("Etag", fmt.Sprintf(`"%s %s"`, r.URL.Path, f.hash()))
+		json.NewEncoder(w).Encode(value)
+		return
+	}
+
+	if f.before != nil {
+		f.before(f)
+	}
+	f.writes = append(f.writes, r.Method+" "+r.URL.Path)
+	if match := r.Header.Get("If-Match"); match != "" && !strings.HasSuffix(match, " "+f.hash()+`"`) {
+		http.Error(w, "If-Match header did not match", http.StatusPreconditionFailed)
+		return
+	}
+	var value interface{}
+	json.NewDecoder(r.Body).Decode(&value)
+	if len(segments) == 0 {
+		f.config = value
+		return
+	}
+
+	parent := f.config
+	for _, key := range segments[:len(segments)-1] {
+		obj, _ := parent.(map[string]interface{})
+		parent = obj[key]
+	}
+	obj, ok := parent.(map[string]interface{})
+	key := segments[len(segments)-1]
+	switch {
+	case !ok:
+		http.Error(w, "parent does not exist", http.StatusBadRequest)
+	case r.Method == "PUT" && obj[key] != nil:
+		http.Error(w, "key already exists: "+key, http.StatusConflict)
+	case r.Method == "POST":
+		if list, isList := obj[key].([]interface{}); isList {
+			obj[key] = append(list, value)
+			return
+		}
+		obj[key] = value
+	default:
+		obj[key] = value
+	}
+}
+
+func decodeConfig(t *testing.T, s string) interface{} {
+	var v interface{}
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+// The bootstrap only adds the missing server; foreign servers, routes and apps stay
+func TestEnsureServerKeepsForeignConfig(t *testing.T) {
+	fake := &fakeCaddy{config: decodeConfig(t, `{
+		"admin": {"listen": "localhost:2019"},
+		"apps": {
+			"http": {"servers": {"static": {"listen": [":8080"], "routes": [{"@id": "blog"}]}}},
+			"tls": {"automation": {"policies": [{"subjects": ["blog.example.com"]}]}}
+		}
+	}`)}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	client := NewCaddyClient(srv.URL)
+	if err := client.EnsureServer(); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.AddRoute(buildRoute("tenant-alice", []string{"alice.localhost"}, "/run/pilot/alice.sock", nil)); err != nil {
+		t.Fatal(err)
+	}
+	// Idempotent: a second run changes nothing
+	if err := client.EnsureServer(); err != nil {
+		t.Fatal(err)
+	}
+
+	apps := fake.config.(map[string]interface{})["apps"].(map[string]interface{})
+	servers := apps["http"].(map[string]interface{})["servers"].(map[string]interface{})
+	if static, _ := json.Marshal(servers["static"]); string(static) != `{"listen":[":8080"],"routes":[{"@id":"blog"}]}` {
+		t.Errorf("foreign server was changed: %s", static)
+	}
+	if apps["tls"] == nil || fake.config.(map[string]interface{})["admin"] == nil {
+		t.Errorf("foreign config was removed: %v", fake.config)
+	}
+	routes, _ := servers["srv0"].(map[string]interface{})["routes"].([]interface{})
+	if len(routes) != 1 {
+		t.Errorf("srv0 has %d routes, want 1", len(routes))
+	}
+	want := []string{"PUT /config/apps/http/servers/srv0", "POST /config/apps/http/servers/srv0/routes"}
+	if !slices.Equal(fake.writes, want) {
+		t.Errorf("writes = %v, want %v", fake.writes, want)
+	}
+}
+
+// A write based on a config that was changed in the meantime is retried on the new config
+func TestEnsureServerRetriesOnConflict(t *testing.T) {
+	fake := &fakeCaddy{config: decodeConfig(t, `{"apps": {}}`)}
+	fake.before = func(f *fakeCaddy) {
+		f.before = nil
+		f.config.(map[string]interface{})["apps"] = map[string]interface{}{
+			"http": map[string]interface{}{"servers": map[string]interface{}{"other": map[string]interface{}{}}},
+		}
+	}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	if err := NewCaddyClient(srv.URL).EnsureServer(); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"PUT /config/apps/http", "PUT /config/apps/http/servers/srv0"}
+	if !slices.Equal(fake.writes, want) {
+		t.Errorf("writes = %v, want %v", fake.writes, want)
+	}
+	servers := fake.config.(map[string]interface{})["apps"].(map[string]interface{})["http"].(map[string]interface{})["servers"].(map[string]interface{})
+	if servers["other"] == nil || servers["srv0"] == nil {
+		t.Errorf("servers = %v, want other and srv0", servers)
+	}
+
+	// If the config keeps changing, the conflict is reported after the retries
+	fake.before = func(f *fakeCaddy) { f.config.(map[string]interface{})["n"] = len(f.writes) }
+	_, err := NewCaddyClient(srv.URL).EnsurePath([]interface{}{}, "apps", "tls")
+	if !errors.Is(err, ErrConfigConflict) {
+		t.Errorf("err = %v, want ErrConfigConflict", err)
+	}
+}
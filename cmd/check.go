@@ -24,7 +24,10 @@ if active, identifies which user they are running under.
 
 If no services are provided, it defaults to checking:
   - caddy.service
-  - postgresql.service`,
+  - postgresql.service
+
+Afterwards the database size of every tenant with a soft quota (--db-size-quota)
+is reported. Exceeded quotas are logged and make the command exit non-zero.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		// Define defaults
 		targetServices := []string{"caddy.service", "postgresql.service"}
@@ -35,6 +38,10 @@ If no services are provided, it defaults to checking:
 		}
 
 		checkServices(targetServices)
+
+		if !checkQuotas() {
+			os.Exit(1)
+		}
 	},
 }
 
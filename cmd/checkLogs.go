@@ -25,18 +25,28 @@ var checkLogsCmd = &cobra.Command{
 }
 
 func CheckLogs(username string) error {
-	// 1. Get UID to find the user
-	u, err := user.Lookup(username)
+	// 1. Get UID from the inventory, falling back to the system user database
+	rec, err := GetTenant(username)
 	if err != nil {
-		return fmt.Errorf("could not find user %s: %v", username, err)
+		return err
+	}
+	uid := ""
+	if rec != nil && rec.UID != "" {
+		uid = rec.UID
+	} else {
+		u, err := user.Lookup(username)
+		if err != nil {
+			return fmt.Errorf("could not find user %s: %v", username, err)
+		}
+		uid = u.Uid
 	}
 
-	fmt.Printf("📜 Fetching logs for tenant '%s' (UID %s)...\n", username, u.Uid)
+	fmt.Printf("📜 Fetching logs for tenant '%s' (UID %s)...\n", username, uid)
 
 	// 2. Fetch logs using journalctl
 	// We use _UID match to see everything running as that user (proxy, service, etc.)
 	// or --user-unit if we want to be specific. _UID is broader and often better for debugging everything.
-	cmd := exec.Command("journalctl", fmt.Sprintf("_UID=%s", u.Uid), "--no-pager", "-n", "50")
+	cmd := exec.Command("journalctl", fmt.Sprintf("_UID=%s", uid), "--no-pager", "-n", "50")
 
 	// Connect stdout/stderr to current terminal
 	out, err := cmd.CombinedOutput()
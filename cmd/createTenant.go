@@ -2,61 +2,225 @@ package cmd
 
 import (
 	"log"
+	"os"
+	"os/user"
 
 	"github.com/spf13/cobra"
 )
 
 var (
-	ctName   string
-	ctDomain string
-	ctIdle   string
+	ctName       string
+	ctDomains    []string
+	ctIdle       string
+	ctApp        appFlags
+	ctLimits     ResourceLimits
+	ctDBLimits   DatabaseLimits
+	ctHardening  string
+	ctActivation string
+	ctProxy      proxyPolicyFlags
 )
 
 var createTenantCmdFull = &cobra.Command{
 	Use:   "create-tenant",
 	Short: "Full provisioning of a tenant (User, DB, Systemd, Proxy)",
 	Long: `Orchestrates the entire provisioning process for a new tenant:
-1. Creates a Linux System User (with lingering enabled).
-2. Creates a PostgreSQL Role and Database (Peer Auth).
-3. Generates and starts Systemd Socket & Service units.
-4. Configures Caddy Reverse Proxy to route traffic.`,
+1. Creates a Linux System User (with lingering enabled), or adopts an
+   existing pilot tenant when re-running after a partial failure.
+2. Creates a PostgreSQL Role and Database (Peer Auth) with optional
+   guardrails (--db-connection-limit, --db-statement-timeout, --db-work-mem,
+   --db-idle-in-transaction-timeout, --db-size-quota).
+3. Generates and starts Systemd Socket & Service units for the tenant's
+   application (--app, --app-arg, --workdir, --env) and cgroup limits
+   (--memory-max, --memory-high, --cpu-quota, --tasks-max, --io-weight, ...),
+   sandboxed with the --hardening profile (none, default, strict).
+   --activation=direct passes the socket to the backend instead of
+   going through systemd-socket-proxyd.
+4. Configures Caddy Reverse Proxy to route traffic of every --domain
+   (repeatable, e.g. apex + www) to the tenant, unless another tenant
+   already claims one of them, with an optional proxy policy
+   (--max-body-size, --header, --basic-auth, --allow, --deny,
+   --dial-timeout, --response-timeout, --rate-limit).
+
+If a step fails, all previous steps are rolled back in reverse order
+and a report of the executed, failed and rolled back steps is printed.
+Steps whose rollback failed are named in the final error.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		if ctName == "" {
 			log.Fatal("Tenant name is required (--name)")
 		}
 
+		app, err := ctApp.spec()
+		if err != nil {
+			log.Fatalf("❌ Invalid application: %v", err)
+		}
+		if err := ctLimits.Validate(); err != nil {
+			log.Fatalf("❌ Invalid limits: %v", err)
+		}
+		if err := ctDBLimits.Validate(); err != nil {
+			log.Fatalf("❌ Invalid database limits: %v", err)
+		}
+		if err := ValidateHardening(ctHardening); err != nil {
+			log.Fatalf("❌ %v", err)
+		}
+		if err := ValidateActivation(ctActivation); err != nil {
+			log.Fatalf("❌ %v", err)
+		}
+		proxy, err := ctProxy.spec(os.Stdin)
+		if err != nil {
+			log.Fatalf("❌ Invalid proxy policy: %v", err)
+		}
+
 		log.Printf("🚀 Starting provisioning for tenant '%s'...\n", ctName)
+		LogAction("CREATE_TENANT", ctName, "STARTED")
 
-		// 1. Create Linux User
-		if err := CreateUser(ctName); err != nil {
-			log.Fatalf("❌ User creation failed: %v", err)
+		rec, err := GetTenant(ctName)
+		if err != nil {
+			log.Fatalf("❌ %v", err)
 		}
+		existed := rec != nil
 
-		// 2. Setup Database
-		if err := SetupDatabase(ctName); err != nil {
-			log.Fatalf("❌ Database setup failed: %v", err)
+		if app != nil {
+			if err := SetTenantApp(ctName, app); err != nil {
+				log.Fatalf("❌ %v", err)
+			}
+		}
+		if !ctLimits.IsZero() {
+			if err := SetTenantLimits(ctName, ctLimits, false); err != nil {
+				log.Fatalf("❌ %v", err)
+			}
 		}
 
-		// 3. Setup Systemd
-		if err := SetupSystemd(ctName, ctIdle); err != nil {
-			log.Fatalf("❌ Systemd setup failed: %v", err)
+		if !ctDBLimits.IsZero() {
+			if err := SetTenantDBLimits(ctName, ctDBLimits, false); err != nil {
+				log.Fatalf("❌ %v", err)
+			}
+		}
+		if ctHardening != "" {
+			if err := SetTenantHardening(ctName, ctHardening); err != nil {
+				log.Fatalf("❌ %v", err)
+			}
+		}
+		if ctActivation != "" {
+			if err := SetTenantActivation(ctName, ctActivation); err != nil {
+				log.Fatalf("❌ %v", err)
+			}
+		}
+		if !proxy.IsZero() {
+			if err := SetTenantProxyPolicy(ctName, proxy, false); err != nil {
+				log.Fatalf("❌ %v", err)
+			}
 		}
 
-		// 4. Setup Proxy
-		if err := SetupProxy(ctName, ctDomain, ""); err != nil {
-			log.Fatalf("❌ Proxy setup failed: %v", err)
+		results, err := RunSteps(tenantSteps(ctName, ctDomains, ctIdle))
+		printStepReport(results)
+		if err != nil {
+			if stateErr := recordFailedProvisioning(ctName, existed, results); stateErr != nil {
+				log.Printf("⚠️  Failed to update tenant inventory: %v", stateErr)
+			}
+			LogAction("CREATE_TENANT", ctName, "FAILED")
+			if !rolledBack(results) {
+				log.Fatalf("❌ Provisioning of tenant '%s' failed (%s): %v\n   Remove the leftovers with 'pilot delete-tenant --name=%s' or re-run create-tenant.", ctName, rollbackSummary(results), err, ctName)
+			}
+			log.Fatalf("❌ Provisioning of tenant '%s' failed (%s): %v", ctName, rollbackSummary(results), err)
 		}
 
+		LogAction("CREATE_TENANT", ctName, "SUCCESS")
 		log.Printf("🎉 Success! Tenant '%s' is fully provisioned and ready.\n", ctName)
 	},
 }
 
+// tenantSteps returns the provisioning steps of a tenant, each paired with its teardown
+// so a failure rolls back everything before it. Resources that already existed before
+// the run (e.g. when re-running after a partial failure) are never torn down.
+func tenantSteps(name string, domains []string, idle string) []ProvisionStep {
+	var userExisted, dbExisted, unitsExisted, portExisted, routeExisted bool
+
+	return []ProvisionStep{
+		{
+			Name: ComponentUser,
+			Do: func() error {
+				_, err := user.Lookup(name)
+				userExisted = err == nil
+				return CreateUser(name)
+			},
+			Undo: func() error {
+				if userExisted {
+					return nil
+				}
+				return DeleteUser(name, false)
+			},
+		},
+		{
+			Name: ComponentDatabase,
+			Do: func() error {
+				var err error
+				if dbExisted, err = databaseExists(name); err != nil {
+					return err
+				}
+				return SetupDatabase(name)
+			},
+			Undo: func() error {
+				if dbExisted {
+					return nil
+				}
+				return DropDatabase(name)
+			},
+		},
+		{
+			Name: ComponentSystemd,
+			Do: func() error {
+				if u, err := user.Lookup(name); err == nil {
+					units, _ := readUnits(u.HomeDir)
+					unitsExisted = units[tenantUnits[0]] != ""
+				}
+				st, err := LoadState()
+				if err != nil {
+					return err
+				}
+				portExisted = st.allocatedPort(name, PortBackend) != 0
+				return SetupSystemd(name, idle)
+			},
+			Undo: func() error {
+				if !unitsExisted {
+					if err := TeardownSystemd(name); err != nil {
+						return err
+					}
+				}
+				if portExisted {
+					return nil
+				}
+				return ReleasePort(name, PortBackend)
+			},
+		},
+		{
+			Name: ComponentProxy,
+			Do: func() error {
+				exists, err := NewCaddyClient("").RouteExists(tenantRouteID(name))
+				routeExisted = err == nil && exists
+				return SetupProxy(name, domains, "")
+			},
+			Undo: func() error {
+				if routeExisted {
+					return nil
+				}
+				return RemoveProxy(name)
+			},
+		},
+	}
+}
+
 func init() {
 	rootCmd.AddCommand(createTenantCmdFull)
 
 	createTenantCmdFull.Flags().StringVarP(&ctName, "name", "n", "", "Tenant Name (linux username) [Required]")
-	createTenantCmdFull.Flags().StringVarP(&ctDomain, "domain", "d", "", "Custom Domain (e.g. app.example.com)")
+	createTenantCmdFull.Flags().StringSliceVarP(&ctDomains, "domain", "d", nil, "Domain of the tenant route, repeatable for aliases (e.g. app.example.com)")
 	createTenantCmdFull.Flags().StringVarP(&ctIdle, "idle", "i", "5min", "Idle timeout for socket activation")
+	addAppFlags(createTenantCmdFull, &ctApp)
+	addLimitFlags(createTenantCmdFull, &ctLimits)
+	addDBLimitFlags(createTenantCmdFull, &ctDBLimits)
+	addProxyPolicyFlags(createTenantCmdFull, &ctProxy)
+	createTenantCmdFull.Flags().StringVar(&ctActivation, "activation", "", "Socket activation mode: proxy, direct (default: proxy)")
+	createTenantCmdFull.Flags().StringVar(&ctHardening, "hardening", "", "Sandboxing profile of the backend: none, default, strict (default: default)")
 
 	_ = createTenantCmdFull.MarkFlagRequired("name")
 }
@@ -7,8 +7,9 @@ import (
 	"fmt"
 	"log"
 	"os"
-	"os/exec"
 	"os/user"
+	"slices"
+	"strconv"
 	"time"
 
 	"github.com/spf13/cobra"
@@ -17,33 +18,49 @@ import (
 // Variable to store the flag value
 var tenantName string
 
-// CreateUser creates a new system user, enables lingering, and ensures the user service is running
+// tenantGroup is the marker group every pilot-managed user is a member of
+const tenantGroup = "pilot-tenants"
+
+// minTenantUID is the lowest UID pilot will ever adopt (below are system accounts)
+const minTenantUID = 1000
+
+// CreateUser creates a new system user, enables lingering, and ensures the user service is running.
+// An existing user is adopted if it is a pilot-managed tenant, so the call is idempotent.
 func CreateUser(username string) error {
-	// 1. Create the user
-	fmt.Printf("👤 Creating user '%s'...\n", username)
+	if err := ValidateUsername(username); err != nil {
+		return fmt.Errorf("security check failed: %v", err)
+	}
+
+	// 1. Create the user (or adopt an existing tenant)
+	if existing, err := user.Lookup(username); err == nil {
+		if err := checkManagedUser(existing); err != nil {
+			return err
+		}
+		fmt.Printf("   ℹ️  User '%s' already exists and is a pilot tenant, continuing.\n", username)
+	} else {
+		if err := ensureTenantGroup(); err != nil {
+			return err
+		}
 
-	// -m: Create home directory
-	// -s: Set shell to bash
-	userCmd := exec.Command("useradd", "-m", "-s", "/bin/bash", username)
+		fmt.Printf("👤 Creating user '%s'...\n", username)
 
-	if out, err := userCmd.CombinedOutput(); err != nil {
-		// Ignore error if user already exists (exit code 9)
-		// But CombinedOutput doesn't give exit code easily without type assertion.
-		// For robustness in "fix this now" mode, let's fail if it fails, assuming clean slate or manual cleanup.
-		return fmt.Errorf("failed to create user: %v, Output: %s", err, string(out))
+		// -m: Create home directory
+		// -s: Set shell to bash
+		// -G: Add to the marker group so pilot can recognize its tenants later
+		if out, err := runCommand("useradd", "-m", "-s", "/bin/bash", "-G", tenantGroup, username); err != nil {
+			return fmt.Errorf("failed to create user: %v, Output: %s", err, string(out))
+		}
 	}
 
 	// 2. Lookup the user to get UID (needed for systemctl and wait loop)
-	u, err := user.Lookup(username)
+	u, err := lookupTenantUser(username)
 	if err != nil {
 		return fmt.Errorf("failed to lookup user %s after creation: %v", username, err)
 	}
 
 	// 3. Enable Lingering
 	fmt.Printf("⚙️  Enabling systemd lingering for '%s'...\n", username)
-	lingerCmd := exec.Command("loginctl", "enable-linger", username)
-
-	if out, err := lingerCmd.CombinedOutput(); err != nil {
+	if out, err := runCommand("loginctl", "enable-linger", username); err != nil {
 		return fmt.Errorf("failed to enable linger: %v, Output: %s", err, string(out))
 	}
 
@@ -51,8 +68,7 @@ func CreateUser(username string) error {
 	// This forces systemd to create /run/user/<UID> and the bus socket immediately
 	serviceName := fmt.Sprintf("user@%s.service", u.Uid)
 	fmt.Printf("🚀 Starting systemd service '%s'...\n", serviceName)
-	startCmd := exec.Command("systemctl", "start", serviceName)
-	if out, err := startCmd.CombinedOutput(); err != nil {
+	if out, err := runCommand("systemctl", "start", serviceName); err != nil {
 		return fmt.Errorf("failed to start user service: %v, Output: %s", err, string(out))
 	}
 
@@ -63,8 +79,13 @@ func CreateUser(username string) error {
 	timeout := 10 * time.Second
 	start := time.Now()
 	for time.Since(start) < timeout {
-		if _, err := os.Stat(busPath); err == nil {
+		if _, err := os.Stat(busPath); err == nil || dryRun {
 			fmt.Printf("✅ User bus is ready.\n")
+			if err := recordComponent(username, ComponentUser, StepDone, func(t *TenantRecord) {
+				t.UID = u.Uid
+			}); err != nil {
+				return err
+			}
 			fmt.Printf("✅ Success! Tenant '%s' is ready.\n", username)
 			return nil
 		}
@@ -74,6 +95,101 @@ func CreateUser(username string) error {
 	return fmt.Errorf("timeout waiting for user bus at %s (is systemd-logind running?)", busPath)
 }
 
+// DeleteUser disables lingering, stops the user manager and removes the system user.
+// If keepHome is true the home directory is left on disk.
+func DeleteUser(username string, keepHome bool) error {
+	if err := ValidateUsername(username); err != nil {
+		return fmt.Errorf("security check failed: %v", err)
+	}
+
+	u, err := user.Lookup(username)
+	if err != nil {
+		fmt.Printf("   ℹ️  User '%s' does not exist.\n", username)
+		return nil
+	}
+	if err := checkManagedUser(u); err != nil {
+		return err
+	}
+
+	// 1. Disable Lingering
+	fmt.Printf("⚙️  Disabling systemd lingering for '%s'...\n", username)
+	if out, err := runCommand("loginctl", "disable-linger", username); err != nil {
+		return fmt.Errorf("failed to disable linger: %v, Output: %s", err, string(out))
+	}
+
+	// 2. Stop the user service
+	// userdel refuses to remove a user that still has running processes
+	serviceName := fmt.Sprintf("user@%s.service", u.Uid)
+	fmt.Printf("🛑 Stopping systemd service '%s'...\n", serviceName)
+	if out, err := runCommand("systemctl", "stop", serviceName); err != nil {
+		return fmt.Errorf("failed to stop user service: %v, Output: %s", err, string(out))
+	}
+
+	// 3. Delete the user
+	// -r: Remove home directory and mail spool
+	args := []string{username}
+	if keepHome {
+		fmt.Printf("👤 Deleting user '%s' (keeping %s)...\n", username, u.HomeDir)
+	} else {
+		fmt.Printf("👤 Deleting user '%s' and %s...\n", username, u.HomeDir)
+		args = append([]string{"-r"}, args...)
+	}
+	if out, err := runCommand("userdel", args...); err != nil {
+		return fmt.Errorf("failed to delete user: %v, Output: %s", err, string(out))
+	}
+
+	if err := clearComponent(username, ComponentUser); err != nil {
+		return err
+	}
+
+	fmt.Printf("✅ User '%s' removed.\n", username)
+	return nil
+}
+
+// checkManagedUser refuses system accounts and users that pilot did not create.
+// A user counts as managed if it is in the marker group or recorded in the inventory.
+func checkManagedUser(u *user.User) error {
+	uid, err := strconv.Atoi(u.Uid)
+	if err != nil {
+		return fmt.Errorf("invalid UID %s for user %s: %v", u.Uid, u.Username, err)
+	}
+	if uid < minTenantUID {
+		return fmt.Errorf("refusing to manage system account '%s' (UID %d)", u.Username, uid)
+	}
+
+	if g, err := user.LookupGroup(tenantGroup); err == nil {
+		gids, err := u.GroupIds()
+		if err != nil {
+			return fmt.Errorf("failed to read groups of user %s: %v", u.Username, err)
+		}
+		if slices.Contains(gids, g.Gid) {
+			return nil
+		}
+	}
+
+	rec, err := GetTenant(u.Username)
+	if err != nil {
+		return err
+	}
+	if rec != nil && rec.UID == u.Uid {
+		return nil
+	}
+
+	return fmt.Errorf("refusing to manage user '%s': not a pilot tenant (not in group '%s' or the inventory)", u.Username, tenantGroup)
+}
+
+// ensureTenantGroup creates the marker group if it does not exist yet
+func ensureTenantGroup() error {
+	if _, err := user.LookupGroup(tenantGroup); err == nil {
+		return nil
+	}
+	fmt.Printf("👥 Creating group '%s'...\n", tenantGroup)
+	if out, err := runCommand("groupadd", "--system", tenantGroup); err != nil {
+		return fmt.Errorf("failed to create group %s: %v, Output: %s", tenantGroup, err, string(out))
+	}
+	return nil
+}
+
 // createTenantCmd represents the create-tenant command
 var createTenantCmd = &cobra.Command{
 	Use:   "create-user",
@@ -81,9 +197,13 @@ var createTenantCmd = &cobra.Command{
 	Long: `Creates a new Linux user for a specific tenant.
     
 This command performs two main system operations:
-1. useradd -m -s /bin/bash <name>: Creates the user and home directory.
+1. useradd -m -s /bin/bash -G pilot-tenants <name>: Creates the user and home directory.
 2. loginctl enable-linger <name>: Allows the user's systemd instance to run at boot without login.
 
+If the user already exists and is a pilot tenant (member of the 'pilot-tenants'
+group or recorded in the inventory), it is adopted and only lingering and the
+user manager are (re-)configured. System and human accounts are refused.
+
 Example:
   pilot create-user --name="omar"`,
 	Run: func(cmd *cobra.Command, args []string) {
@@ -0,0 +1,229 @@
+package cmd
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Default directory of the PostgreSQL unix socket (Debian/Ubuntu); PGHOST overrides it
+const defaultPGHost = "/var/run/postgresql"
+
+// OS user and role pilot administers PostgreSQL as
+const postgresSuperuser = "postgres"
+
+// ErrPostgresUnavailable is returned when no connection to PostgreSQL could be
+// established, as opposed to a role or database that does not exist
+var ErrPostgresUnavailable = errors.New("cannot connect to PostgreSQL")
+
+// adminDB is the connection pool of the postgres superuser, opened on first use
+var adminDB *sql.DB
+
+// peerDialer connects to PostgreSQL as a given OS user, so the server's peer
+// authentication maps the connection to the role of the same name
+type peerDialer struct {
+	uid    int
+	dialer net.Dialer
+}
+
+func (d peerDialer) Dial(network, address string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, address)
+}
+
+func (d peerDialer) DialTimeout(network, address string, timeout time.Duration) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return d.DialContext(ctx, network, address)
+}
+
+func (d peerDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	var conn net.Conn
+	err := asEffectiveUID(d.uid, func() error {
+		var err error
+		conn, err = d.dialer.DialContext(ctx, network, address)
+		return err
+	})
+	return conn, err
+}
+
+// dsnQuote quotes a value of a libpq connection string
+func dsnQuote(v string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(v) + "'"
+}
+
+// openPostgres connects to a database over the local socket as the OS user of the
+// same name as role (peer authentication) and checks that the connection works
+func openPostgres(role, dbname string) (*sql.DB, error) {
+	u, err := user.Lookup(role)
+	if err != nil {
+		return nil, fmt.Errorf("%w: OS user %s not found: %v", ErrPostgresUnavailable, role, err)
+	}
+	uid, err := strconv.Atoi(u.Uid)
+	if err != nil {
+		return nil, fmt.Errorf("invalid UID for user %s: %v", role, err)
+	}
+
+	host := os.Getenv("PGHOST")
+	if host == "" {
+		host = defaultPGHost
+	}
+	dsn := fmt.Sprintf("host=%s user=%s dbname=%s sslmode=disable connect_timeout=5",
+		dsnQuote(host), dsnQuote(role), dsnQuote(dbname))
+
+	connector, err := pq.NewConnector(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("invalid connection settings: %v", err)
+	}
+	connector.Dialer(peerDialer{uid: uid})
+
+	db := sql.OpenDB(connector)
+	db.SetMaxOpenConns(1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("%w as '%s' via %s: %v", ErrPostgresUnavailable, role, host, err)
+	}
+	return db, nil
+}
+
+// admin returns the connection of the postgres superuser
+func admin() (*sql.DB, error) {
+	if adminDB != nil {
+		return adminDB, nil
+	}
+	db, err := openPostgres(postgresSuperuser, "postgres")
+	if err != nil {
+		return nil, err
+	}
+	adminDB = db
+	return adminDB, nil
+}
+
+// adminExec runs a statement as the postgres superuser (recorded in dry-run mode)
+func adminExec(stmt string) error {
+	if dryRun {
+		recordChange("sql", stmt, "")
+		return nil
+	}
+	db, err := admin()
+	if err != nil {
+		return err
+	}
+	if _, err := db.Exec(stmt); err != nil {
+		return fmt.Errorf("%s: %v", stmt, err)
+	}
+	return nil
+}
+
+// adminQueryRow runs a read-only query as the postgres superuser.
+// It returns false (and no error) if the query yields no row.
+func adminQueryRow(query string, args []any, dest ...any) (bool, error) {
+	db, err := admin()
+	if err != nil {
+		return false, err
+	}
+	err = db.QueryRow(query, args...).Scan(dest...)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("query failed: %v", err)
+	}
+	return true, nil
+}
+
+// databaseExists checks whether a database with the given name exists
+func databaseExists(name string) (bool, error) {
+	var one int
+	return adminQueryRow("SELECT 1 FROM pg_database WHERE datname = $1", []any{name}, &one)
+}
+
+// roleExists checks whether a role with the given name exists
+func roleExists(name string) (bool, error) {
+	var one int
+	return adminQueryRow("SELECT 1 FROM pg_roles WHERE rolname = $1", []any{name}, &one)
+}
+
+// databaseOwner returns the name of the role that owns a database, or "" if it does not exist
+func databaseOwner(name string) (string, error) {
+	var owner string
+	_, err := adminQueryRow("SELECT pg_get_userbyid(datdba) FROM pg_database WHERE datname = $1", []any{name}, &owner)
+	return owner, err
+}
+
+// createRole creates a login role without special privileges, unless it exists.
+// Check and creation run in one transaction, serialized by an advisory lock on the
+// role name, so concurrent pilot runs cannot both create it.
+// It reports whether the role was created by this call.
+func createRole(name string) (bool, error) {
+	stmt := fmt.Sprintf("CREATE ROLE %s LOGIN NOSUPERUSER NOCREATEDB NOCREATEROLE", pq.QuoteIdentifier(name))
+	if dryRun {
+		exists, err := roleExists(name)
+		if err != nil || exists {
+			return false, err
+		}
+		recordChange("sql", stmt, "")
+		return true, nil
+	}
+
+	db, err := admin()
+	if err != nil {
+		return false, err
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("failed to start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext($1))", "pilot-role:"+name); err != nil {
+		return false, fmt.Errorf("failed to lock role %s: %v", name, err)
+	}
+	var one int
+	switch err := tx.QueryRow("SELECT 1 FROM pg_roles WHERE rolname = $1", name).Scan(&one); err {
+	case nil:
+		return false, nil
+	case sql.ErrNoRows:
+	default:
+		return false, fmt.Errorf("query failed: %v", err)
+	}
+	if _, err := tx.Exec(stmt); err != nil {
+		return false, fmt.Errorf("failed to create role %s: %v", name, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to create role %s: %v", name, err)
+	}
+	return true, nil
+}
+
+// createDatabase creates a database owned by the role of the same name.
+// CREATE DATABASE cannot run inside a transaction block.
+func createDatabase(name string) error {
+	return adminExec(fmt.Sprintf("CREATE DATABASE %s OWNER %s", pq.QuoteIdentifier(name), pq.QuoteIdentifier(name)))
+}
+
+// alterDatabaseOwner hands a database to another role
+func alterDatabaseOwner(name, owner string) error {
+	return adminExec(fmt.Sprintf("ALTER DATABASE %s OWNER TO %s", pq.QuoteIdentifier(name), pq.QuoteIdentifier(owner)))
+}
+
+// dropDatabase drops a database
+func dropDatabase(name string) error {
+	return adminExec("DROP DATABASE " + pq.QuoteIdentifier(name))
+}
+
+// dropRole drops a role
+func dropRole(name string) error {
+	return adminExec("DROP ROLE " + pq.QuoteIdentifier(name))
+}
@@ -0,0 +1,289 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/lib/pq"
+	"github.com/spf13/cobra"
+)
+
+var (
+	pgDurationRegex = regexp.MustCompile(`^[0-9]+(us|ms|s|min|h|d)?$`)
+	pgSizeRegex     = regexp.MustCompile(`^([0-9]+)(kB|MB|GB|TB)?$`)
+)
+
+// DatabaseLimits are the guardrails of a tenant in the shared PostgreSQL cluster.
+// Empty fields fall back to the cluster defaults (no connection limit, no quota).
+type DatabaseLimits struct {
+	ConnectionLimit          string `json:"connection_limit,omitempty" yaml:"connection_limit"`
+	StatementTimeout         string `json:"statement_timeout,omitempty" yaml:"statement_timeout"`
+	IdleInTransactionTimeout string `json:"idle_in_transaction_session_timeout,omitempty" yaml:"idle_in_transaction_session_timeout"`
+	WorkMem                  string `json:"work_mem,omitempty" yaml:"work_mem"`
+	// Soft quota: not enforced by PostgreSQL, reported by "pilot check"
+	SizeQuota string `json:"size_quota,omitempty" yaml:"size_quota"`
+}
+
+// settings returns the role settings pilot manages, in a stable order
+func (l *DatabaseLimits) settings() []struct{ name, value string } {
+	var d DatabaseLimits
+	if l != nil {
+		d = *l
+	}
+	return []struct{ name, value string }{
+		{"statement_timeout", d.StatementTimeout},
+		{"idle_in_transaction_session_timeout", d.IdleInTransactionTimeout},
+		{"work_mem", d.WorkMem},
+	}
+}
+
+// Validate checks every set value against the syntax PostgreSQL accepts
+func (l *DatabaseLimits) Validate() error {
+	if l.ConnectionLimit != "" {
+		if n, err := strconv.Atoi(l.ConnectionLimit); err != nil || n < -1 {
+			return fmt.Errorf("invalid connection limit '%s' (must be a number, -1 for unlimited)", l.ConnectionLimit)
+		}
+	}
+	for _, s := range l.settings() {
+		switch {
+		case s.value == "":
+		case s.name == "work_mem" && !pgSizeRegex.MatchString(s.value):
+			return fmt.Errorf("invalid value '%s' for %s (e.g. 4MB)", s.value, s.name)
+		case s.name != "work_mem" && !pgDurationRegex.MatchString(s.value):
+			return fmt.Errorf("invalid value '%s' for %s (e.g. 30s, 5min)", s.value, s.name)
+		}
+	}
+	if l.SizeQuota != "" {
+		if _, err := parsePGSize(l.SizeQuota); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// connectionLimit returns the desired CONNECTION LIMIT (-1 = unlimited)
+func (l *DatabaseLimits) connectionLimit() int {
+	if l == nil || l.ConnectionLimit == "" {
+		return -1
+	}
+	n, _ := strconv.Atoi(l.ConnectionLimit)
+	return n
+}
+
+// Merge returns a copy of l where every field set in update overrides the current value
+func (l *DatabaseLimits) Merge(update DatabaseLimits) DatabaseLimits {
+	merged := DatabaseLimits{}
+	if l != nil {
+		merged = *l
+	}
+	set := func(dst *string, v string) {
+		if v != "" {
+			*dst = v
+		}
+	}
+	set(&merged.ConnectionLimit, update.ConnectionLimit)
+	set(&merged.StatementTimeout, update.StatementTimeout)
+	set(&merged.IdleInTransactionTimeout, update.IdleInTransactionTimeout)
+	set(&merged.WorkMem, update.WorkMem)
+	set(&merged.SizeQuota, update.SizeQuota)
+	return merged
+}
+
+// IsZero reports whether no limit is set
+func (l *DatabaseLimits) IsZero() bool {
+	return l == nil || *l == DatabaseLimits{}
+}
+
+// parsePGSize parses a PostgreSQL size ("512MB", "5GB") into bytes
+func parsePGSize(s string) (int64, error) {
+	m := pgSizeRegex.FindStringSubmatch(s)
+	if m == nil {
+		return 0, fmt.Errorf("invalid size '%s' (e.g. 512MB, 5GB)", s)
+	}
+	n, err := strconv.ParseInt(m[1], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size '%s': %v", s, err)
+	}
+	shift := map[string]uint{"": 0, "kB": 10, "MB": 20, "GB": 30, "TB": 40}[m[2]]
+	return n << shift, nil
+}
+
+// formatBytes renders a byte count like pg_size_pretty
+func formatBytes(n int64) string {
+	units := []string{"bytes", "kB", "MB", "GB", "TB"}
+	i := 0
+	for n >= 10*1024 && i < len(units)-1 {
+		n /= 1024
+		i++
+	}
+	return fmt.Sprintf("%d %s", n, units[i])
+}
+
+// dbLimitStatements returns the ALTER ROLE statements that turn the current
+// connection limit and role settings (pg_roles.rolconfig) into the desired ones.
+// Settings pilot does not manage are left alone.
+func dbLimitStatements(role string, want *DatabaseLimits, connLimit int, config []string) []string {
+	var stmts []string
+	ident := pq.QuoteIdentifier(role)
+
+	if want.connectionLimit() != connLimit {
+		stmts = append(stmts, fmt.Sprintf("ALTER ROLE %s CONNECTION LIMIT %d", ident, want.connectionLimit()))
+	}
+
+	current := map[string]string{}
+	for _, c := range config {
+		if k, v, ok := strings.Cut(c, "="); ok {
+			current[k] = v
+		}
+	}
+	for _, s := range want.settings() {
+		have, set := current[s.name]
+		switch {
+		case s.value == "" && set:
+			stmts = append(stmts, fmt.Sprintf("ALTER ROLE %s RESET %s", ident, s.name))
+		case s.value != "" && (!set || have != s.value):
+			stmts = append(stmts, fmt.Sprintf("ALTER ROLE %s SET %s = %s", ident, s.name, pq.QuoteLiteral(s.value)))
+		}
+	}
+	return stmts
+}
+
+// pendingDBLimits returns the statements needed to apply the limits to a tenant's role.
+// A role that does not exist yet is treated as having the defaults.
+func pendingDBLimits(role string, want *DatabaseLimits) ([]string, error) {
+	connLimit, config := -1, []string(nil)
+	var arr pq.StringArray
+	found, err := adminQueryRow("SELECT rolconnlimit, rolconfig FROM pg_roles WHERE rolname = $1", []any{role}, &connLimit, &arr)
+	if err != nil {
+		return nil, err
+	}
+	if found {
+		config = arr
+	}
+	return dbLimitStatements(role, want, connLimit, config), nil
+}
+
+// applyDBLimits brings the role settings of a tenant in line with its limits
+func applyDBLimits(role string, want *DatabaseLimits) error {
+	stmts, err := pendingDBLimits(role, want)
+	if err != nil {
+		return err
+	}
+	if len(stmts) > 0 {
+		fmt.Printf("   📏 Applying database limits for '%s'...\n", role)
+	}
+	for _, stmt := range stmts {
+		if err := adminExec(stmt); err != nil {
+			return fmt.Errorf("failed to apply database limits: %v", err)
+		}
+	}
+	return nil
+}
+
+// databaseSize returns the size of a database in bytes
+func databaseSize(name string) (int64, error) {
+	var size int64
+	found, err := adminQueryRow("SELECT pg_database_size(datname) FROM pg_database WHERE datname = $1", []any{name}, &size)
+	if err == nil && !found {
+		err = fmt.Errorf("database '%s' does not exist", name)
+	}
+	return size, err
+}
+
+// addDBLimitFlags registers the database limit flags shared by several commands
+func addDBLimitFlags(cmd *cobra.Command, l *DatabaseLimits) {
+	cmd.Flags().StringVar(&l.ConnectionLimit, "db-connection-limit", "", "Maximum concurrent connections of the tenant role (-1 = unlimited)")
+	cmd.Flags().StringVar(&l.StatementTimeout, "db-statement-timeout", "", "statement_timeout of the tenant role (e.g. 30s)")
+	cmd.Flags().StringVar(&l.IdleInTransactionTimeout, "db-idle-in-transaction-timeout", "", "idle_in_transaction_session_timeout of the tenant role (e.g. 5min)")
+	cmd.Flags().StringVar(&l.WorkMem, "db-work-mem", "", "work_mem of the tenant role (e.g. 4MB)")
+	cmd.Flags().StringVar(&l.SizeQuota, "db-size-quota", "", "Soft database size quota reported by 'pilot check' (e.g. 5GB)")
+}
+
+// SetTenantDBLimits merges the given limits into the tenant's stored database limits
+func SetTenantDBLimits(username string, update DatabaseLimits, reset bool) error {
+	if err := update.Validate(); err != nil {
+		return err
+	}
+	err := UpdateTenant(username, func(t *TenantRecord) {
+		current := t.DBLimits
+		if reset {
+			current = nil
+		}
+		merged := current.Merge(update)
+		t.DBLimits = &merged
+		if t.DBLimits.IsZero() {
+			t.DBLimits = nil
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update tenant inventory: %v", err)
+	}
+	return nil
+}
+
+// QuotaUsage is the size of a tenant's database compared with its soft quota
+type QuotaUsage struct {
+	Tenant   string
+	Size     int64
+	Quota    int64
+	Exceeded bool
+	Err      error
+}
+
+// collectQuotaUsage returns the usage of every tenant with a size quota
+func collectQuotaUsage(st *State) []QuotaUsage {
+	var usages []QuotaUsage
+	for _, name := range st.Names() {
+		rec := st.Tenants[name]
+		if rec.DBLimits == nil || rec.DBLimits.SizeQuota == "" {
+			continue
+		}
+		u := QuotaUsage{Tenant: name}
+		u.Quota, u.Err = parsePGSize(rec.DBLimits.SizeQuota)
+		if u.Err == nil {
+			u.Size, u.Err = databaseSize(name)
+		}
+		u.Exceeded = u.Err == nil && u.Size > u.Quota
+		usages = append(usages, u)
+	}
+	return usages
+}
+
+// checkQuotas prints the quota usage of all tenants and raises an alert
+// (central log entry) for every exceeded quota. It reports whether all are within quota.
+func checkQuotas() bool {
+	st, err := LoadState()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load tenant inventory: %v\n", err)
+		return false
+	}
+	usages := collectQuotaUsage(st)
+	if len(usages) == 0 {
+		return true
+	}
+
+	fmt.Println()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "TENANT\tDB SIZE\tQUOTA\tUSAGE\tSTATUS")
+	fmt.Fprintln(w, "------\t-------\t-----\t-----\t------")
+	ok := true
+	for _, u := range usages {
+		switch {
+		case u.Err != nil:
+			fmt.Fprintf(w, "%s\t-\t-\t-\t❌ %v\n", u.Tenant, u.Err)
+			ok = false
+		case u.Exceeded:
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d%%\t⚠️  quota exceeded\n", u.Tenant, formatBytes(u.Size), formatBytes(u.Quota), u.Size*100/u.Quota)
+			LogAction("DB_QUOTA", u.Tenant, "EXCEEDED")
+			ok = false
+		default:
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d%%\tok\n", u.Tenant, formatBytes(u.Size), formatBytes(u.Quota), u.Size*100/u.Quota)
+		}
+	}
+	w.Flush()
+	return ok
+}
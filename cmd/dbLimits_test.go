@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestDBLimitStatements(t *testing.T) {
+	want := &DatabaseLimits{ConnectionLimit: "10", StatementTimeout: "30s", WorkMem: "4MB"}
+
+	// Fresh role: everything has to be set
+	got := dbLimitStatements("alice", want, -1, nil)
+	wantStmts := []string{
+		`ALTER ROLE "alice" CONNECTION LIMIT 10`,
+		`ALTER ROLE "alice" SET statement_timeout = '30s'`,
+		`ALTER ROLE "alice" SET work_mem = '4MB'`,
+	}
+	if !slices.Equal(got, wantStmts) {
+		t.Errorf("dbLimitStatements() = %q, want %q", got, wantStmts)
+	}
+
+	// Converged role, including a setting pilot does not manage
+	config := []string{"statement_timeout=30s", "work_mem=4MB", "search_path=app"}
+	if got := dbLimitStatements("alice", want, 10, config); len(got) != 0 {
+		t.Errorf("dbLimitStatements() on converged role = %q, want none", got)
+	}
+
+	// Removed limits are reset
+	got = dbLimitStatements("alice", nil, 10, config)
+	wantStmts = []string{
+		`ALTER ROLE "alice" CONNECTION LIMIT -1`,
+		`ALTER ROLE "alice" RESET statement_timeout`,
+		`ALTER ROLE "alice" RESET work_mem`,
+	}
+	if !slices.Equal(got, wantStmts) {
+		t.Errorf("dbLimitStatements() reset = %q, want %q", got, wantStmts)
+	}
+}
+
+func TestDatabaseLimitsValidate(t *testing.T) {
+	valid := DatabaseLimits{ConnectionLimit: "-1", StatementTimeout: "5min", IdleInTransactionTimeout: "0", WorkMem: "64kB", SizeQuota: "5GB"}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("Validate() error = %v", err)
+	}
+	for _, bad := range []DatabaseLimits{
+		{ConnectionLimit: "-2"},
+		{StatementTimeout: "30 seconds"},
+		{WorkMem: "4mb"},
+		{SizeQuota: "5G"},
+		{WorkMem: "1'; DROP ROLE x; --"},
+	} {
+		if err := bad.Validate(); err == nil {
+			t.Errorf("Validate() accepted %+v", bad)
+		}
+	}
+
+	if n, err := parsePGSize("5GB"); err != nil || n != 5<<30 {
+		t.Errorf("parsePGSize(5GB) = %d, %v", n, err)
+	}
+}
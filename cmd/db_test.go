@@ -0,0 +1,29 @@
+package cmd
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDSNQuote(t *testing.T) {
+	tests := map[string]string{
+		"/var/run/postgresql": `'/var/run/postgresql'`,
+		"it's":                `'it\'s'`,
+		`a\b`:                 `'a\\b'`,
+	}
+	for in, want := range tests {
+		if got := dsnQuote(in); got != want {
+			t.Errorf("dsnQuote(%q) = %s, want %s", in, got, want)
+		}
+	}
+}
+
+func TestOpenPostgresUnavailable(t *testing.T) {
+	// No server listens in an empty directory
+	t.Setenv("PGHOST", t.TempDir())
+
+	_, err := openPostgres(postgresSuperuser, "postgres")
+	if !errors.Is(err, ErrPostgresUnavailable) {
+		t.Errorf("openPostgres() error = %v, want ErrPostgresUnavailable", err)
+	}
+}
@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os/user"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	dtName     string
+	dtKeepData bool
+	dtForce    bool
+)
+
+var deleteTenantCmd = &cobra.Command{
+	Use:   "delete-tenant",
+	Short: "Removes a tenant and everything create-tenant provisioned",
+	Long: `Tears down a tenant in the reverse order of create-tenant:
+1. Removes the Caddy route (tenant-<name>).
+2. Disables and removes the Systemd Socket & Service units.
+3. Drops the PostgreSQL Database and Role.
+4. Disables lingering and deletes the Linux System User.
+
+Steps for resources that do not exist are skipped, so partially
+provisioned tenants can be cleaned up as well.
+
+Only tenants pilot manages (in the inventory, or whose Linux user is a
+pilot tenant) are removed. --force removes the leftovers of an unknown
+name (route, units, database); a Linux user pilot did not create is
+never deleted.
+
+With --keep-data the home directory and the database are preserved.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := ValidateUsername(dtName); err != nil {
+			log.Fatalf("❌ %v", err)
+		}
+
+		log.Printf("🧹 Starting teardown for tenant '%s'...\n", dtName)
+		LogAction("DELETE_TENANT", dtName, "STARTED")
+
+		if err := DeleteTenant(dtName, dtKeepData, dtForce); err != nil {
+			LogAction("DELETE_TENANT", dtName, "FAILED")
+			log.Fatalf("⚠️  %v", err)
+		}
+
+		LogAction("DELETE_TENANT", dtName, "SUCCESS")
+		log.Printf("🗑️  Tenant '%s' has been removed.\n", dtName)
+	},
+}
+
+// DeleteTenant removes all resources of a tenant in the reverse order of create-tenant.
+// Every step is attempted even if an earlier one failed; the tenant is only dropped
+// from the inventory (releasing its ports) once all of them succeeded.
+// Unless force is set, nothing is touched for a name pilot does not manage.
+func DeleteTenant(name string, keepData, force bool) error {
+	if err := checkManagedTenant(name); err != nil {
+		if !force {
+			return err
+		}
+		log.Printf("⚠️  %v, removing whatever exists on the host (--force).\n", err)
+	}
+
+	failed := false
+
+	// 1. Remove Proxy
+	if err := RemoveProxy(name); err != nil {
+		log.Printf("❌ Proxy removal failed: %v", err)
+		failed = true
+	}
+
+	// 2. Teardown Systemd
+	if err := TeardownSystemd(name); err != nil {
+		log.Printf("❌ Systemd teardown failed: %v", err)
+		failed = true
+	}
+
+	// 3. Drop Database
+	if keepData {
+		log.Printf("ℹ️  Keeping database for '%s' (--keep-data).\n", name)
+	} else if err := DropDatabase(name); err != nil {
+		log.Printf("❌ Database removal failed: %v", err)
+		failed = true
+	}
+
+	// 4. Delete Linux User
+	if err := DeleteUser(name, keepData); err != nil {
+		log.Printf("❌ User removal failed: %v", err)
+		failed = true
+	}
+
+	if failed {
+		return fmt.Errorf("tenant '%s' was only partially removed, see errors above", name)
+	}
+
+	if err := RemoveTenant(name); err != nil {
+		return fmt.Errorf("failed to update tenant inventory: %v", err)
+	}
+	return nil
+}
+
+// checkManagedTenant refuses names that are neither in the inventory nor the
+// Linux user of a pilot tenant, so their database, units and route are left alone
+func checkManagedTenant(name string) error {
+	rec, err := GetTenant(name)
+	if err != nil {
+		return err
+	}
+	if rec != nil {
+		return nil
+	}
+	u, err := user.Lookup(name)
+	if err != nil {
+		return fmt.Errorf("tenant '%s' is not managed by pilot", name)
+	}
+	if err := checkManagedUser(u); err != nil {
+		return fmt.Errorf("tenant '%s' is not managed by pilot: %v", name, err)
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(deleteTenantCmd)
+
+	deleteTenantCmd.Flags().StringVarP(&dtName, "name", "n", "", "Tenant Name (linux username) [Required]")
+	deleteTenantCmd.Flags().BoolVar(&dtKeepData, "keep-data", false, "Preserve the home directory and database")
+	deleteTenantCmd.Flags().BoolVar(&dtForce, "force", false, "Also remove the leftovers of a name that is not managed by pilot")
+
+	_ = deleteTenantCmd.MarkFlagRequired("name")
+}
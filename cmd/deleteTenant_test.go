@@ -0,0 +1,29 @@
+package cmd
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckManagedTenant(t *testing.T) {
+	stateFile = filepath.Join(t.TempDir(), "state.json")
+	defer func() { stateFile = defaultStatePath }()
+	if err := UpdateTenant("alice", func(t *TenantRecord) {}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := checkManagedTenant("alice"); err != nil {
+		t.Errorf("checkManagedTenant(alice) = %v, want nil", err)
+	}
+	for _, name := range []string{"postgres_app_db", "root"} {
+		if err := checkManagedTenant(name); err == nil || !strings.Contains(err.Error(), "not managed by pilot") {
+			t.Errorf("checkManagedTenant(%s) = %v, want not managed", name, err)
+		}
+	}
+
+	// Refused before any teardown step runs
+	if err := DeleteTenant("postgres_app_db", false, false); err == nil {
+		t.Error("DeleteTenant() removed a name pilot does not manage")
+	}
+}
@@ -0,0 +1,320 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/user"
+	"reflect"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	driftName string
+	driftFix  bool
+)
+
+// Divergence is a difference between what pilot expects and what is on the host
+type Divergence struct {
+	Tenant    string
+	Component string
+	Item      string
+	Problem   string
+}
+
+var driftCmd = &cobra.Command{
+	Use:   "drift",
+	Short: "Detects configuration drift of managed tenants",
+	Long: `Compares the expected configuration of every managed tenant with the host:
+  - re-renders the systemd unit templates and compares them with ~/.config/systemd/user
+    (units of the other activation mode must not exist)
+  - fetches /id/tenant-<name> from Caddy and compares it with the route pilot would build
+    (serving the maintenance page in maintenance mode) and checks the tenant's error
+    route (tenant-<name>-errors) and TLS automation policies (tls-tenant-<name>-acme|internal)
+  - checks that the tenant's database exists and is owned by the tenant role
+  - checks the role's connection limit and settings against the stored database limits
+
+With --fix every divergence is repaired by re-running the matching setup step.
+Exits non-zero if drift remains.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		st, err := LoadState()
+		if err != nil {
+			log.Fatalf("❌ Error: %v", err)
+		}
+
+		names := st.Names()
+		if driftName != "" {
+			if st.Tenants[driftName] == nil {
+				log.Fatalf("❌ Tenant '%s' is not managed by pilot", driftName)
+			}
+			names = []string{driftName}
+		}
+
+		var all []Divergence
+		for _, name := range names {
+			divs, err := detectDrift(st.Tenants[name])
+			if err != nil {
+				log.Fatalf("❌ Failed to check tenant '%s': %v", name, err)
+			}
+			all = append(all, divs...)
+		}
+
+		if len(all) == 0 {
+			fmt.Println("✅ No drift detected.")
+			return
+		}
+		printDrift(all)
+
+		if !driftFix {
+			log.Fatalf("⚠️  %d divergence(s) found. Re-run with --fix to repair.", len(all))
+		}
+
+		LogAction("DRIFT_FIX", driftName, "STARTED")
+		failed := false
+		for _, name := range names {
+			if err := fixDrift(st.Tenants[name], all); err != nil {
+				log.Printf("❌ Failed to repair tenant '%s': %v", name, err)
+				failed = true
+			}
+		}
+		if failed {
+			LogAction("DRIFT_FIX", driftName, "FAILED")
+			log.Fatal("⚠️  Some divergences could not be repaired, see above.")
+		}
+		LogAction("DRIFT_FIX", driftName, "SUCCESS")
+		fmt.Println("\n✅ All divergences repaired.")
+	},
+}
+
+// detectDrift compares the expected configuration of a tenant with the host
+func detectDrift(rec *TenantRecord) ([]Divergence, error) {
+	var divs []Divergence
+	add := func(component, item, problem string) {
+		divs = append(divs, Divergence{Tenant: rec.Name, Component: component, Item: item, Problem: problem})
+	}
+
+	// 1. User & Units
+	if _, err := user.Lookup(rec.Name); err != nil {
+		add(ComponentUser, rec.Name, "user missing")
+	} else {
+		config, err := tenantSystemdConfig(rec.Name, rec.IdleTime)
+		if err != nil {
+			return nil, err
+		}
+		want, err := renderUnits(config)
+		if err != nil {
+			return nil, err
+		}
+		have, err := readUnits(config.HomeDir)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range unitFiles {
+			content, wanted := want[name]
+			switch {
+			case !wanted:
+				if have[name] != "" {
+					add(ComponentSystemd, name, "unit file not expected")
+				}
+			case have[name] == "":
+				add(ComponentSystemd, name, "unit file missing")
+			case have[name] != content:
+				add(ComponentSystemd, name, "unit file modified")
+			}
+		}
+	}
+
+	// 2. Caddy Route & TLS Policies
+	if err := detectProxyDrift(rec, add); err != nil {
+		return nil, err
+	}
+
+	// 3. Database Ownership
+	owner, err := databaseOwner(rec.Name)
+	if err != nil {
+		return nil, err
+	}
+	switch owner {
+	case "":
+		add(ComponentDatabase, rec.Name, "database missing")
+	case rec.Name:
+	default:
+		add(ComponentDatabase, rec.Name, fmt.Sprintf("owned by '%s'", owner))
+	}
+
+	// 4. Database Limits
+	if exists, err := roleExists(rec.Name); err != nil {
+		return nil, err
+	} else if exists {
+		changes, err := pendingDBLimits(rec.Name, rec.DBLimits)
+		if err != nil {
+			return nil, err
+		}
+		if len(changes) > 0 {
+			add(ComponentDatabase, rec.Name, fmt.Sprintf("%d role setting(s) differ", len(changes)))
+		}
+	}
+
+	return divs, nil
+}
+
+// detectProxyDrift compares the tenant's routes and TLS policies with the live Caddy config
+func detectProxyDrift(rec *TenantRecord, add func(component, item, problem string)) error {
+	routeID := tenantRouteID(rec.Name)
+	raw, err := NewCaddyClient("").GetRouteJSON(routeID)
+	if err != nil {
+		return fmt.Errorf("failed to contact Caddy API: %v (is Caddy running?)", err)
+	}
+	if raw == nil {
+		add(ComponentProxy, routeID, "route missing")
+	} else {
+		equal, err := configEqual(raw, tenantRoute(rec, tenantDomains(rec), tenantUpstream(rec)))
+		if err != nil {
+			return err
+		}
+		if !equal {
+			add(ComponentProxy, routeID, "route modified")
+		}
+	}
+	errorRouteID := tenantErrorRouteID(rec.Name)
+	raw, err = NewCaddyClient("").GetRouteJSON(errorRouteID)
+	if err != nil {
+		return fmt.Errorf("failed to contact Caddy API: %v (is Caddy running?)", err)
+	}
+	if raw == nil {
+		add(ComponentProxy, errorRouteID, "error route missing")
+	} else {
+		equal, err := configEqual(raw, errorRoute(rec, tenantDomains(rec)))
+		if err != nil {
+			return err
+		}
+		if !equal {
+			add(ComponentProxy, errorRouteID, "error route modified")
+		}
+	}
+	policies := buildTLSPolicies(rec.Name, tenantDomains(rec))
+	for _, issuer := range tlsIssuers {
+		id, policy := tlsPolicyID(rec.Name, issuer), policies[tlsPolicyID(rec.Name, issuer)]
+		raw, err := NewCaddyClient("").GetRouteJSON(id)
+		if err != nil {
+			return fmt.Errorf("failed to contact Caddy API: %v (is Caddy running?)", err)
+		}
+		switch {
+		case policy == nil && raw != nil:
+			add(ComponentProxy, id, "TLS policy not expected")
+		case policy == nil:
+		case raw == nil:
+			add(ComponentProxy, id, "TLS policy missing")
+		default:
+			equal, err := configEqual(raw, policy)
+			if err != nil {
+				return err
+			}
+			if !equal {
+				add(ComponentProxy, id, "TLS policy modified")
+			}
+		}
+	}
+	return nil
+}
+
+// fixDrift re-runs the setup steps for every component of a tenant that diverged
+func fixDrift(rec *TenantRecord, divs []Divergence) error {
+	broken := map[string]bool{}
+	for _, d := range divs {
+		if d.Tenant == rec.Name {
+			broken[d.Component] = true
+		}
+	}
+	if len(broken) == 0 {
+		return nil
+	}
+
+	fmt.Printf("\n--- Repairing tenant '%s' ---\n", rec.Name)
+
+	if broken[ComponentUser] {
+		if err := CreateUser(rec.Name); err != nil {
+			return err
+		}
+	}
+	if broken[ComponentDatabase] {
+		if err := SetupDatabase(rec.Name); err != nil {
+			return err
+		}
+		if err := fixDatabaseOwner(rec.Name); err != nil {
+			return err
+		}
+	}
+	if broken[ComponentSystemd] || broken[ComponentUser] {
+		if err := SetupSystemd(rec.Name, rec.IdleTime); err != nil {
+			return err
+		}
+	}
+	if broken[ComponentProxy] {
+		if err := SetupProxy(rec.Name, tenantDomains(rec), ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fixDatabaseOwner hands the tenant's database back to the tenant role
+func fixDatabaseOwner(name string) error {
+	owner, err := databaseOwner(name)
+	if err != nil {
+		return err
+	}
+	if owner == "" || owner == name {
+		return nil
+	}
+	fmt.Printf("   🔧 Restoring owner of database '%s'...\n", name)
+	if err := alterDatabaseOwner(name, name); err != nil {
+		return fmt.Errorf("failed to change database owner: %v", err)
+	}
+	return nil
+}
+
+// tenantDomains returns the domains of a tenant's route, the first one being the primary
+func tenantDomains(rec *TenantRecord) []string {
+	if len(rec.Domains) > 0 {
+		return rec.Domains
+	}
+	return []string{fmt.Sprintf("%s.localhost", rec.Name)}
+}
+
+// configEqual compares an object fetched from Caddy (route, TLS policy) with the expected one.
+// Both sides are normalized to generic JSON so key order and unmodeled fields count.
+func configEqual(actual json.RawMessage, expected interface{}) (bool, error) {
+	want, err := json.Marshal(expected)
+	if err != nil {
+		return false, err
+	}
+
+	var a, b interface{}
+	if err := json.Unmarshal(actual, &a); err != nil {
+		return false, fmt.Errorf("failed to decode Caddy config: %v", err)
+	}
+	if err := json.Unmarshal(want, &b); err != nil {
+		return false, err
+	}
+	return reflect.DeepEqual(a, b), nil
+}
+
+func printDrift(divs []Divergence) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "TENANT\tCOMPONENT\tITEM\tPROBLEM")
+	fmt.Fprintln(w, "------\t---------\t----\t-------")
+	for _, d := range divs {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", d.Tenant, d.Component, d.Item, d.Problem)
+	}
+	w.Flush()
+}
+
+func init() {
+	rootCmd.AddCommand(driftCmd)
+	driftCmd.Flags().StringVarP(&driftName, "name", "n", "", "Only check a single tenant")
+	driftCmd.Flags().BoolVar(&driftFix, "fix", false, "Repair every divergence")
+}
@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestConfigEqual(t *testing.T) {
+	route := buildRoute("tenant-alice", []string{"alice.localhost"}, "/run/pilot/alice.sock", nil)
+
+	tests := []struct {
+		name  string
+		raw   string
+		equal bool
+	}{
+		{
+			"reordered keys",
+			`{"handle": [{"upstreams": [{"dial": "unix//run/pilot/alice.sock"}], "handler": "reverse_proxy"}],
+			  "match": [{"host": ["alice.localhost"]}], "@id": "tenant-alice"}`,
+			true,
+		},
+		{
+			"extra handler field",
+			`{"@id": "tenant-alice", "match": [{"host": ["alice.localhost"]}],
+			  "handle": [{"handler": "reverse_proxy", "upstreams": [{"dial": "unix//run/pilot/alice.sock"}], "flush_interval": -1}]}`,
+			false,
+		},
+		{
+			"other upstream",
+			`{"@id": "tenant-alice", "match": [{"host": ["alice.localhost"]}],
+			  "handle": [{"handler": "reverse_proxy", "upstreams": [{"dial": "localhost:9000"}]}]}`,
+			false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			equal, err := configEqual(json.RawMessage(tt.raw), route)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if equal != tt.equal {
+				t.Errorf("configEqual = %v, want %v", equal, tt.equal)
+			}
+		})
+	}
+
+	if _, err := configEqual(json.RawMessage(`{"@id":`), route); err == nil {
+		t.Error("expected an error for invalid JSON")
+	}
+}
+
+// The expected routes and policies of a tenant compare equal to what pilot writes,
+// and every missing object yields its own divergence
+func TestDetectProxyDrift(t *testing.T) {
+	domains := []string{"alice.localhost", "alice.example.com"}
+	policies := buildTLSPolicies("alice", domains)
+
+	tests := []struct {
+		name     string
+		upstream string // stored in the inventory
+		live     string // upstream of the route in Caddy
+		omit     string
+		want     []string
+	}{
+		{"in sync", "", tenantSocketPath("alice"), "", nil},
+		{"custom upstream in sync", "localhost:9000", "localhost:9000", "", nil},
+		{"custom upstream replaced", "localhost:9000", tenantSocketPath("alice"), "", []string{"tenant-alice: route modified"}},
+		{"route missing", "", "", tenantRouteID("alice"), []string{"tenant-alice: route missing"}},
+		{"error route missing", "", tenantSocketPath("alice"), tenantErrorRouteID("alice"), []string{tenantErrorRouteID("alice") + ": error route missing"}},
+		{"policy missing", "", tenantSocketPath("alice"), tlsPolicyID("alice", IssuerACME), []string{tlsPolicyID("alice", IssuerACME) + ": TLS policy missing"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := &TenantRecord{Name: "alice", Domains: domains, Upstream: tt.upstream}
+			var routes, errorRoutes, automation []interface{}
+			if id := tenantRouteID("alice"); id != tt.omit {
+				routes = append(routes, tenantRoute(rec, domains, tt.live))
+			}
+			if id := tenantErrorRouteID("alice"); id != tt.omit {
+				errorRoutes = append(errorRoutes, errorRoute(rec, domains))
+			}
+			for id, policy := range policies {
+				if id != tt.omit {
+					automation = append(automation, policy)
+				}
+			}
+			raw, _ := json.Marshal(map[string]interface{}{
+				"apps": map[string]interface{}{
+					"http": map[string]interface{}{"servers": map[string]interface{}{
+						"srv0": map[string]interface{}{
+							"routes": routes,
+							"errors": map[string]interface{}{"routes": errorRoutes},
+						},
+					}},
+					"tls": map[string]interface{}{"automation": map[string]interface{}{"policies": automation}},
+				},
+			})
+			fake := &fakeCaddy{}
+			json.Unmarshal(raw, &fake.config)
+			srv := httptest.NewServer(fake)
+			defer srv.Close()
+			caddyAdmin = srv.URL
+			defer func() { caddyAdmin = defaultCaddyAdmin }()
+
+			var got []string
+			err := detectProxyDrift(rec, func(component, item, problem string) {
+				if component != ComponentProxy {
+					t.Errorf("component = %s, want %s", component, ComponentProxy)
+				}
+				got = append(got, item+": "+problem)
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("divergences = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"strings"
+)
+
+// dryRun is set by the global --dry-run flag. When enabled, every side effect
+// (commands, file writes, Caddy API calls, state updates) is recorded and
+// printed instead of executed. Read-only queries still run against the host.
+var dryRun bool
+
+// Change is a single side effect that was recorded in dry-run mode
+type Change struct {
+	Kind   string // exec, write, remove, mkdir, caddy, sql
+	Target string
+	Detail string
+}
+
+var recordedChanges []Change
+
+// recordChange stores a change and prints it immediately, so it shows up in context
+func recordChange(kind, target, detail string) {
+	recordedChanges = append(recordedChanges, Change{Kind: kind, Target: target, Detail: detail})
+
+	fmt.Printf("📝 [dry-run] %s: %s\n", kind, target)
+	if detail != "" {
+		for _, line := range strings.Split(strings.TrimRight(detail, "\n"), "\n") {
+			fmt.Printf("    │ %s\n", line)
+		}
+	}
+}
+
+// runCommand executes a command that changes the host and returns its combined output
+func runCommand(name string, args ...string) ([]byte, error) {
+	if dryRun {
+		recordChange("exec", shellJoin(append([]string{name}, args...)), "")
+		return nil, nil
+	}
+	return exec.Command(name, args...).CombinedOutput()
+}
+
+// runCommandToFile executes a command that changes the host and writes its stdout to path
+// (created with mode 0600). Stderr is returned as the output.
+func runCommandToFile(path string, name string, args ...string) ([]byte, error) {
+	if dryRun {
+		recordChange("exec", shellJoin(append([]string{name}, args...))+" > "+shellQuote(path), "")
+		return nil, nil
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s: %v", path, err)
+	}
+	defer f.Close()
+
+	var stderr strings.Builder
+	cmd := exec.Command(name, args...)
+	cmd.Stdout = f
+	cmd.Stderr = &stderr
+	err = cmd.Run()
+	return []byte(stderr.String()), err
+}
+
+// runCommandFromFile executes a command that changes the host with path as its stdin
+// and returns its combined output
+func runCommandFromFile(path string, name string, args ...string) ([]byte, error) {
+	if dryRun {
+		recordChange("exec", shellJoin(append([]string{name}, args...))+" < "+shellQuote(path), "")
+		return nil, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	cmd := exec.Command(name, args...)
+	cmd.Stdin = f
+	return cmd.CombinedOutput()
+}
+
+// makeDir creates a directory and forces its permissions (MkdirAll respects umask)
+func makeDir(path string, perm os.FileMode) error {
+	if dryRun {
+		recordChange("mkdir", path, fmt.Sprintf("mode %04o", perm))
+		return nil
+	}
+	if err := os.MkdirAll(path, perm); err != nil {
+		return fmt.Errorf("failed to create directory %s: %v", path, err)
+	}
+	if err := os.Chmod(path, perm); err != nil {
+		return fmt.Errorf("failed to chmod directory %s: %v", path, err)
+	}
+	return nil
+}
+
+// removeFile deletes a file, ignoring files that do not exist
+func removeFile(path string) error {
+	if _, err := os.Lstat(path); os.IsNotExist(err) {
+		return nil
+	}
+	if dryRun {
+		recordChange("remove", path, "")
+		return nil
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove %s: %v", path, err)
+	}
+	return nil
+}
+
+// lookupTenantUser looks up a system user. In dry-run mode a user that would have
+// been created by an earlier (recorded) step is replaced by a placeholder.
+func lookupTenantUser(username string) (*user.User, error) {
+	u, err := user.Lookup(username)
+	if err != nil && dryRun {
+		return &user.User{
+			Uid:      "<uid>",
+			Gid:      "<gid>",
+			Username: username,
+			HomeDir:  "/home/" + username,
+		}, nil
+	}
+	return u, err
+}
+
+// printDryRunSummary reports how many changes were recorded
+func printDryRunSummary() {
+	if !dryRun {
+		return
+	}
+	fmt.Printf("\n📝 Dry-run: %d change(s) would be applied. Nothing was changed.\n", len(recordedChanges))
+}
+
+// shellJoin renders a command line with POSIX shell quoting where needed
+func shellJoin(args []string) string {
+	quoted := make([]string, len(args))
+	for i, a := range args {
+		quoted[i] = shellQuote(a)
+	}
+	return strings.Join(quoted, " ")
+}
+
+func shellQuote(s string) string {
+	if s == "" {
+		return "''"
+	}
+	if strings.IndexFunc(s, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_./=:@%+,", r))
+	}) == -1 {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
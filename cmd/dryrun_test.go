@@ -0,0 +1,35 @@
+package cmd
+
+import "testing"
+
+func TestShellJoin(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"useradd", "-m", "-s", "/bin/bash", "alice"}, "useradd -m -s /bin/bash alice"},
+		{[]string{"psql", "-tAc", "SELECT 1"}, "psql -tAc 'SELECT 1'"},
+		{[]string{"echo", "it's"}, `echo 'it'\''s'`},
+		{[]string{"echo", ""}, "echo ''"},
+	}
+
+	for _, tt := range tests {
+		if got := shellJoin(tt.args); got != tt.want {
+			t.Errorf("shellJoin(%q) = %s, want %s", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestRunCommandDryRun(t *testing.T) {
+	dryRun = true
+	recordedChanges = nil
+	defer func() { dryRun = false; recordedChanges = nil }()
+
+	// Would fail loudly if it were actually executed
+	if _, err := runCommand("/nonexistent/useradd", "alice"); err != nil {
+		t.Fatalf("runCommand() in dry-run returned error: %v", err)
+	}
+	if len(recordedChanges) != 1 || recordedChanges[0].Target != "/nonexistent/useradd alice" {
+		t.Errorf("recordedChanges = %+v, want one exec change", recordedChanges)
+	}
+}
@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestHardeningDirectives(t *testing.T) {
+	if got := hardeningDirectives(HardeningNone, "/home/alice"); len(got) != 0 {
+		t.Errorf("none profile rendered %q", got)
+	}
+
+	def := hardeningDirectives("", "/home/alice")
+	if !slices.Equal(def, hardeningDirectives(HardeningDefault, "/home/alice")) {
+		t.Error("empty profile does not select the default profile")
+	}
+	if slices.Contains(def, "ProtectHome=read-only") {
+		t.Error("default profile should leave the home writable")
+	}
+
+	strict := hardeningDirectives(HardeningStrict, "/home/alice")
+	for _, want := range []string{"ProtectSystem=strict", "ProtectHome=read-only", "ReadWritePaths=/home/alice/data", "CapabilityBoundingSet="} {
+		if !slices.Contains(strict, want) {
+			t.Errorf("strict profile misses %q", want)
+		}
+	}
+	if slices.Contains(strict, "ProtectSystem=full") {
+		t.Error("strict profile renders ProtectSystem twice")
+	}
+
+	if err := ValidateHardening("paranoid"); err == nil {
+		t.Error("ValidateHardening() accepted an unknown profile")
+	}
+}
@@ -0,0 +1,235 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// Drop-in of rest-api.service that carries the tenant's cgroup limits
+const limitsDropIn = "rest-api.service.d/50-pilot-limits.conf"
+
+// 4. LIMITS: cgroup v2 resource control for the backend
+// Kept in a drop-in so set-limits can change it without touching the service unit
+const limitsTmpl = `# Managed by pilot (set-limits). Manual changes will be overwritten.
+[Service]
+{{- range .Limits}}
+{{.}}
+{{- end}}
+`
+
+var (
+	bytesRegex   = regexp.MustCompile(`^[0-9]+[KMGT]?$`)
+	percentRegex = regexp.MustCompile(`^[0-9]+%$`)
+)
+
+// ResourceLimits are the systemd resource control settings of a tenant's backend.
+// Empty fields are not rendered, so systemd's defaults apply.
+type ResourceLimits struct {
+	MemoryMax     string `json:"memory_max,omitempty" yaml:"memory_max"`
+	MemoryHigh    string `json:"memory_high,omitempty" yaml:"memory_high"`
+	MemorySwapMax string `json:"memory_swap_max,omitempty" yaml:"memory_swap_max"`
+	CPUQuota      string `json:"cpu_quota,omitempty" yaml:"cpu_quota"`
+	CPUWeight     string `json:"cpu_weight,omitempty" yaml:"cpu_weight"`
+	TasksMax      string `json:"tasks_max,omitempty" yaml:"tasks_max"`
+	IOWeight      string `json:"io_weight,omitempty" yaml:"io_weight"`
+}
+
+// fields returns the directive names and values in a stable order
+func (l *ResourceLimits) fields() []struct{ name, value string } {
+	return []struct{ name, value string }{
+		{"MemoryMax", l.MemoryMax},
+		{"MemoryHigh", l.MemoryHigh},
+		{"MemorySwapMax", l.MemorySwapMax},
+		{"CPUQuota", l.CPUQuota},
+		{"CPUWeight", l.CPUWeight},
+		{"TasksMax", l.TasksMax},
+		{"IOWeight", l.IOWeight},
+	}
+}
+
+// Validate checks every set value against the syntax systemd accepts
+func (l *ResourceLimits) Validate() error {
+	for _, f := range l.fields() {
+		if f.value == "" {
+			continue
+		}
+		var ok bool
+		switch f.name {
+		case "MemoryMax", "MemoryHigh", "MemorySwapMax":
+			ok = f.value == "infinity" || bytesRegex.MatchString(f.value) || percentRegex.MatchString(f.value)
+		case "CPUQuota":
+			ok = percentRegex.MatchString(f.value)
+		case "TasksMax":
+			n, err := strconv.Atoi(f.value)
+			ok = f.value == "infinity" || (err == nil && n >= 1) || percentRegex.MatchString(f.value)
+		case "CPUWeight", "IOWeight":
+			n, err := strconv.Atoi(f.value)
+			ok = err == nil && n >= 1 && n <= 10000
+		}
+		if !ok {
+			return fmt.Errorf("invalid value '%s' for %s", f.value, f.name)
+		}
+	}
+	return nil
+}
+
+// Directives renders the set limits as unit file lines (e.g. "MemoryMax=512M")
+func (l *ResourceLimits) Directives() []string {
+	if l == nil {
+		return nil
+	}
+	var lines []string
+	for _, f := range l.fields() {
+		if f.value != "" {
+			lines = append(lines, f.name+"="+f.value)
+		}
+	}
+	return lines
+}
+
+// IsZero reports whether no limit is set
+func (l *ResourceLimits) IsZero() bool {
+	return l == nil || len(l.Directives()) == 0
+}
+
+// Merge returns a copy of l where every field set in update overrides the current value
+func (l *ResourceLimits) Merge(update ResourceLimits) ResourceLimits {
+	merged := ResourceLimits{}
+	if l != nil {
+		merged = *l
+	}
+	set := func(dst *string, v string) {
+		if v != "" {
+			*dst = v
+		}
+	}
+	set(&merged.MemoryMax, update.MemoryMax)
+	set(&merged.MemoryHigh, update.MemoryHigh)
+	set(&merged.MemorySwapMax, update.MemorySwapMax)
+	set(&merged.CPUQuota, update.CPUQuota)
+	set(&merged.CPUWeight, update.CPUWeight)
+	set(&merged.TasksMax, update.TasksMax)
+	set(&merged.IOWeight, update.IOWeight)
+	return merged
+}
+
+// addLimitFlags registers the resource limit flags shared by several commands
+func addLimitFlags(cmd *cobra.Command, l *ResourceLimits) {
+	cmd.Flags().StringVar(&l.MemoryMax, "memory-max", "", "Hard memory limit (e.g. 512M, 1G, infinity)")
+	cmd.Flags().StringVar(&l.MemoryHigh, "memory-high", "", "Memory throttling threshold (e.g. 384M)")
+	cmd.Flags().StringVar(&l.MemorySwapMax, "memory-swap-max", "", "Swap limit (e.g. 0, 256M)")
+	cmd.Flags().StringVar(&l.CPUQuota, "cpu-quota", "", "CPU time quota (e.g. 50%, 200% for two cores)")
+	cmd.Flags().StringVar(&l.CPUWeight, "cpu-weight", "", "Relative CPU weight (1-10000, default 100)")
+	cmd.Flags().StringVar(&l.TasksMax, "tasks-max", "", "Maximum number of tasks (e.g. 64, infinity)")
+	cmd.Flags().StringVar(&l.IOWeight, "io-weight", "", "Relative IO weight (1-10000, default 100)")
+}
+
+// SetTenantLimits merges the given limits into the tenant's stored limits
+func SetTenantLimits(username string, update ResourceLimits, reset bool) error {
+	if err := update.Validate(); err != nil {
+		return err
+	}
+	err := UpdateTenant(username, func(t *TenantRecord) {
+		current := t.Limits
+		if reset {
+			current = nil
+		}
+		merged := current.Merge(update)
+		t.Limits = &merged
+		if t.Limits.IsZero() {
+			t.Limits = nil
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update tenant inventory: %v", err)
+	}
+	return nil
+}
+
+var (
+	slName   string
+	slReset  bool
+	slLimits ResourceLimits
+)
+
+var setLimitsCmd = &cobra.Command{
+	Use:   "set-limits",
+	Short: "Updates the cgroup resource limits of a running tenant",
+	Long: `Updates the resource limits of a tenant's backend service.
+
+The limits are stored in the inventory and written to the drop-in
+~/.config/systemd/user/` + limitsDropIn + `.
+A daemon-reload applies them to the running service without a restart.
+
+Only the given limits are changed; use --reset to drop all others.
+
+Example:
+  pilot set-limits --name="omar" --memory-max=512M --cpu-quota=50%`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := SetLimits(slName, slLimits, slReset); err != nil {
+			log.Fatalf("❌ Error: %v", err)
+		}
+	},
+}
+
+// SetLimits stores new limits for a tenant and applies them to its running units
+func SetLimits(username string, update ResourceLimits, reset bool) error {
+	rec, err := GetTenant(username)
+	if err != nil {
+		return err
+	}
+	if rec == nil {
+		return fmt.Errorf("tenant '%s' is not managed by pilot", username)
+	}
+
+	if err := SetTenantLimits(username, update, reset); err != nil {
+		return err
+	}
+
+	config, err := tenantSystemdConfig(username, rec.IdleTime)
+	if err != nil {
+		return err
+	}
+	content, err := renderTemplate("limits", limitsTmpl, config)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("📏 Applying limits for %s: %s\n", username, strings.Join(config.Limits, " "))
+
+	systemdDir := filepath.Join(config.HomeDir, ".config/systemd/user")
+	if err := runAsUser(username, "mkdir", "-p", filepath.Join(systemdDir, filepath.Dir(limitsDropIn))); err != nil {
+		return err
+	}
+	if err := writeAsUser(username, content, filepath.Join(systemdDir, limitsDropIn)); err != nil {
+		return err
+	}
+
+	// daemon-reload re-applies resource control settings to running units
+	manager, err := ConnectUserManager(username)
+	if err != nil {
+		return err
+	}
+	defer manager.Close()
+	if err := manager.DaemonReload(); err != nil {
+		return err
+	}
+
+	LogAction("SET_LIMITS", username, "SUCCESS")
+	fmt.Println("✅ Limits applied.")
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(setLimitsCmd)
+	setLimitsCmd.Flags().StringVarP(&slName, "name", "n", "", "Tenant Name (Required)")
+	setLimitsCmd.Flags().BoolVar(&slReset, "reset", false, "Remove all limits that are not given on the command line")
+	addLimitFlags(setLimitsCmd, &slLimits)
+	_ = setLimitsCmd.MarkFlagRequired("name")
+}
@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestResourceLimitsValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		limits  ResourceLimits
+		wantErr bool
+	}{
+		{"Valid memory", ResourceLimits{MemoryMax: "512M", MemoryHigh: "384M", MemorySwapMax: "0"}, false},
+		{"Valid memory percentage", ResourceLimits{MemoryMax: "50%"}, false},
+		{"Valid infinity", ResourceLimits{MemoryMax: "infinity", TasksMax: "infinity"}, false},
+		{"Valid CPU", ResourceLimits{CPUQuota: "200%", CPUWeight: "100", IOWeight: "10000"}, false},
+		{"Valid tasks", ResourceLimits{TasksMax: "64"}, false},
+		{"Valid tasks percentage", ResourceLimits{TasksMax: "10%"}, false},
+		{"Empty", ResourceLimits{}, false},
+		{"Invalid memory unit", ResourceLimits{MemoryMax: "512MB"}, true},
+		{"Invalid CPU quota", ResourceLimits{CPUQuota: "50"}, true},
+		{"Invalid negative tasks", ResourceLimits{TasksMax: "-5"}, true},
+		{"Invalid zero tasks", ResourceLimits{TasksMax: "0"}, true},
+		{"Invalid CPU weight", ResourceLimits{CPUWeight: "0"}, true},
+		{"Invalid IO weight", ResourceLimits{IOWeight: "10001"}, true},
+		{"Invalid injection", ResourceLimits{MemoryMax: "1G\nExecStartPre=/bin/sh"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.limits.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestResourceLimitsMerge(t *testing.T) {
+	current := &ResourceLimits{MemoryMax: "512M", CPUQuota: "50%"}
+	merged := current.Merge(ResourceLimits{CPUQuota: "100%", TasksMax: "64"})
+	want := ResourceLimits{MemoryMax: "512M", CPUQuota: "100%", TasksMax: "64"}
+	if merged != want {
+		t.Errorf("Merge() = %+v, want %+v", merged, want)
+	}
+	if current.CPUQuota != "50%" {
+		t.Error("Merge() modified the current limits")
+	}
+
+	var none *ResourceLimits
+	if got := none.Merge(ResourceLimits{IOWeight: "200"}); got != (ResourceLimits{IOWeight: "200"}) {
+		t.Errorf("Merge() on nil = %+v", got)
+	}
+}
+
+func TestResourceLimitsDirectives(t *testing.T) {
+	tests := []struct {
+		name   string
+		limits *ResourceLimits
+		want   []string
+	}{
+		{"Nil", nil, nil},
+		{"Empty", &ResourceLimits{}, nil},
+		{"Stable order", &ResourceLimits{IOWeight: "200", MemoryMax: "1G", CPUQuota: "50%"}, []string{"MemoryMax=1G", "CPUQuota=50%", "IOWeight=200"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.limits.Directives(); !slices.Equal(got, tt.want) {
+				t.Errorf("Directives() = %q, want %q", got, tt.want)
+			}
+			if zero := tt.limits.IsZero(); zero != (len(tt.want) == 0) {
+				t.Errorf("IsZero() = %v", zero)
+			}
+		})
+	}
+}
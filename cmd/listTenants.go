@@ -0,0 +1,174 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+var listOutput string
+
+// TenantStatus is the live status of a managed tenant
+type TenantStatus struct {
+	Name     string            `json:"name"`
+	UID      string            `json:"uid"`
+	Status   string            `json:"status"`
+	Units    map[string]string `json:"units"`
+	Domains  []string          `json:"domains"`
+	Database bool              `json:"database"`
+	DBError  string            `json:"database_error,omitempty"`
+	IdleTime string            `json:"idle_time"`
+	Route    string            `json:"route"`
+}
+
+var listTenantsCmd = &cobra.Command{
+	Use:   "list-tenants",
+	Short: "Lists all managed tenants with their live status",
+	Long: `Lists every tenant in the inventory together with the state of its
+user-scope units, its Caddy route domain, whether its database exists
+and its idle timeout.
+
+Use --output json for scripting.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if listOutput != "table" && listOutput != "json" {
+			log.Fatalf("❌ Unknown output format '%s' (use table or json)", listOutput)
+		}
+
+		st, err := LoadState()
+		if err != nil {
+			log.Fatalf("❌ Error: %v", err)
+		}
+
+		statuses := make([]TenantStatus, 0, len(st.Tenants))
+		for _, name := range st.Names() {
+			statuses = append(statuses, collectTenantStatus(st.Tenants[name]))
+		}
+
+		if listOutput == "json" {
+			if err := printTenantJSON(os.Stdout, statuses); err != nil {
+				log.Fatalf("❌ Error: %v", err)
+			}
+			return
+		}
+
+		printTenantTable(os.Stdout, statuses)
+	},
+}
+
+// newTenantStatus returns the part of a tenant's status that comes from the inventory
+func newTenantStatus(rec *TenantRecord) TenantStatus {
+	s := TenantStatus{
+		Name:     rec.Name,
+		UID:      rec.UID,
+		Status:   rec.Status,
+		IdleTime: rec.IdleTime,
+	}
+	if rec.Maintenance != nil {
+		s.Status += " (maintenance)"
+	}
+	return s
+}
+
+// collectTenantStatus queries systemd, Caddy and PostgreSQL for the live state of a tenant
+func collectTenantStatus(rec *TenantRecord) TenantStatus {
+	s := newTenantStatus(rec)
+	s.Units = userUnitStates(rec.Name, rec.UID)
+
+	exists, err := databaseExists(rec.Name)
+	if err != nil {
+		s.DBError = err.Error()
+	}
+	s.Database = exists
+
+	route, err := NewCaddyClient("").GetRoute(tenantRouteID(rec.Name))
+	switch {
+	case err != nil:
+		s.Route = "caddy-unreachable"
+	case route == nil:
+		s.Route = "missing"
+	default:
+		s.Route = "present"
+		s.Domains = route.Hosts()
+	}
+
+	return s
+}
+
+// userUnitStates returns the ActiveState of the tenant's user units.
+// If the user manager is not running every unit is reported as "no-manager".
+func userUnitStates(username, uid string) map[string]string {
+	states := map[string]string{}
+
+	if _, err := os.Stat(fmt.Sprintf("/run/user/%s/bus", uid)); uid == "" || err != nil {
+		for _, unit := range tenantUnits {
+			states[unit] = "no-manager"
+		}
+		return states
+	}
+
+	active := map[string]string{}
+	if manager, err := ConnectUserManager(username); err == nil {
+		active, _ = manager.ActiveStates(tenantUnits...)
+		manager.Close()
+	}
+	for _, unit := range tenantUnits {
+		states[unit] = "unknown"
+		if s := active[unit]; s != "" {
+			states[unit] = s
+		}
+	}
+	return states
+}
+
+// printTenantJSON writes the statuses as the JSON array of --output json
+func printTenantJSON(out io.Writer, statuses []TenantStatus) error {
+	data, err := json.MarshalIndent(statuses, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(out, string(data))
+	return err
+}
+
+func printTenantTable(out io.Writer, statuses []TenantStatus) {
+	w := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "TENANT\tUID\tSOCKET\tPROXY\tSERVICE\tDOMAIN\tDATABASE\tIDLE\tSTATUS")
+	fmt.Fprintln(w, "------\t---\t------\t-----\t-------\t------\t--------\t----\t------")
+
+	for _, s := range statuses {
+		domain := strings.Join(s.Domains, ",")
+		if domain == "" {
+			domain = s.Route
+		}
+		db := "missing"
+		if s.Database {
+			db = "present"
+		} else if s.DBError != "" {
+			db = "unreachable"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			s.Name, orDash(s.UID),
+			s.Units[tenantUnits[0]], s.Units[tenantUnits[1]], s.Units[tenantUnits[2]],
+			orDash(domain), db, orDash(s.IdleTime), s.Status)
+	}
+
+	w.Flush()
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func init() {
+	rootCmd.AddCommand(listTenantsCmd)
+	listTenantsCmd.Flags().StringVarP(&listOutput, "output", "o", "table", "Output format (table or json)")
+}
@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// listFixture is a tenant in maintenance mode whose backend unit and database are missing
+func listFixture() []TenantStatus {
+	s := newTenantStatus(&TenantRecord{
+		Name:        "alice",
+		UID:         "1001",
+		Status:      TenantReady,
+		IdleTime:    "5min",
+		Maintenance: &MaintenanceMode{Status: http.StatusServiceUnavailable},
+	})
+	s.Units = map[string]string{tenantUnits[0]: "active", tenantUnits[1]: "inactive", tenantUnits[2]: "unknown"}
+	s.Route = "present"
+	s.Domains = []string{"alice.localhost", "www.alice.localhost"}
+	bob := newTenantStatus(&TenantRecord{Name: "bob", Status: TenantFailed})
+	bob.Units = userUnitStates("bob", "")
+	return []TenantStatus{s, bob}
+}
+
+func TestPrintTenantTable(t *testing.T) {
+	var out bytes.Buffer
+	printTenantTable(&out, listFixture())
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("got %d lines, want header, separator and 2 rows:\n%s", len(lines), out.String())
+	}
+	want := [][]string{
+		{"alice", "1001", "active", "inactive", "unknown", "alice.localhost,www.alice.localhost", "missing", "5min", "ready", "(maintenance)"},
+		{"bob", "-", "no-manager", "no-manager", "no-manager", "-", "missing", "-", "failed"},
+	}
+	for i, fields := range want {
+		if got := strings.Fields(lines[i+2]); strings.Join(got, " ") != strings.Join(fields, " ") {
+			t.Errorf("row %d = %q, want %q", i, got, fields)
+		}
+	}
+}
+
+// The JSON output is used by scripts, its shape must not change by accident
+func TestPrintTenantJSON(t *testing.T) {
+	statuses := listFixture()[:1]
+	statuses[0].DBError = "connection refused"
+
+	var out bytes.Buffer
+	if err := printTenantJSON(&out, statuses); err != nil {
+		t.Fatal(err)
+	}
+	want := `[
+  {
+    "name": "alice",
+    "uid": "1001",
+    "status": "ready (maintenance)",
+    "units": {
+      "rest-api-proxy.service": "inactive",
+      "rest-api.service": "unknown",
+      "rest-api.socket": "active"
+    },
+    "domains": [
+      "alice.localhost",
+      "www.alice.localhost"
+    ],
+    "database": false,
+    "database_error": "connection refused",
+    "idle_time": "5min",
+    "route": "present"
+  }
+]
+`
+	if out.String() != want {
+		t.Errorf("JSON output:\n%s\nwant\n%s", out.String(), want)
+	}
+}
@@ -0,0 +1,329 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// Page served while a tenant is in maintenance mode, unless it has its own offline page
+const defaultMaintenancePage = `<!DOCTYPE html>
+<html lang="en">
+<head><meta charset="utf-8"><title>Down for maintenance</title></head>
+<body style="font-family: sans-serif; text-align: center; padding: 4em;">
+<h1>Down for maintenance</h1>
+<p>This service is being upgraded and will be back shortly.</p>
+</body>
+</html>
+`
+
+// Page served when the tenant's socket is unreachable, unless it has its own offline page
+const defaultOfflinePage = `<!DOCTYPE html>
+<html lang="en">
+<head><meta charset="utf-8"><title>Temporarily unavailable</title></head>
+<body style="font-family: sans-serif; text-align: center; padding: 4em;">
+<h1>Temporarily unavailable</h1>
+<p>This service cannot be reached right now. Please try again in a few minutes.</p>
+</body>
+</html>
+`
+
+// Upstream errors of the reverse proxy that get the offline page
+const offlineErrorMatch = "{http.error.status_code} in [502, 503, 504]"
+
+// MaintenanceMode is the maintenance state of a tenant's route
+type MaintenanceMode struct {
+	Since      time.Time `json:"since"`
+	Status     int       `json:"status"`
+	RetryAfter int       `json:"retry_after,omitempty"` // seconds
+	// The route's reverse_proxy handler before maintenance, restored by "maintenance off"
+	Upstream json.RawMessage `json:"upstream,omitempty"`
+}
+
+// tenantErrorRouteID is the Caddy @id of a tenant's error route (handle_errors)
+func tenantErrorRouteID(username string) string {
+	return fmt.Sprintf("tenant-%s-errors", username)
+}
+
+// maintenanceHandler renders the static response that replaces the reverse proxy
+func maintenanceHandler(m *MaintenanceMode, page string) map[string]interface{} {
+	if page == "" {
+		page = defaultMaintenancePage
+	}
+	headers := map[string][]string{
+		"Content-Type":  {"text/html; charset=utf-8"},
+		"Cache-Control": {"no-store"},
+	}
+	if m.RetryAfter > 0 {
+		headers["Retry-After"] = []string{strconv.Itoa(m.RetryAfter)}
+	}
+	return map[string]interface{}{
+		"handler":     "static_response",
+		"status_code": m.Status,
+		"headers":     headers,
+		"body":        page,
+	}
+}
+
+// tenantRoute builds the route of a tenant from its inventory record: the reverse
+// proxy behind the tenant's proxy policy, or the maintenance page in its place
+func tenantRoute(rec *TenantRecord, domains []string, upstream string) CaddyRoute {
+	route := buildRoute(tenantRouteID(rec.Name), domains, upstream, rec.Proxy)
+	if rec.Maintenance != nil {
+		route.Handle[len(route.Handle)-1] = maintenanceHandler(rec.Maintenance, rec.OfflinePage)
+	}
+	return route
+}
+
+// errorRoute builds the error route of a tenant, which serves the offline page when
+// Caddy cannot reach the tenant's socket
+func errorRoute(rec *TenantRecord, domains []string) CaddyRoute {
+	page := rec.OfflinePage
+	if page == "" {
+		page = defaultOfflinePage
+	}
+	return CaddyRoute{
+		ID: tenantErrorRouteID(rec.Name),
+		Match: []CaddyMatch{{
+			Host:       domains,
+			Expression: offlineErrorMatch,
+		}},
+		Handle: []map[string]interface{}{{
+			"handler":     "static_response",
+			"status_code": "{http.error.status_code}",
+			"headers": map[string][]string{
+				"Content-Type":  {"text/html; charset=utf-8"},
+				"Cache-Control": {"no-store"},
+			},
+			"body": page,
+		}},
+	}
+}
+
+// removeErrorRoute removes the error route of a tenant, if it exists
+func removeErrorRoute(client *CaddyClient, username string) error {
+	id := tenantErrorRouteID(username)
+	raw, err := client.GetRouteJSON(id)
+	if err != nil {
+		return fmt.Errorf("failed to contact Caddy API: %v (is Caddy running?)", err)
+	}
+	if raw == nil {
+		return nil
+	}
+	if err := client.DeleteRoute(id); err != nil {
+		return fmt.Errorf("failed to remove error route %s: %v", id, err)
+	}
+	return nil
+}
+
+// upstreamHandler returns the last handler of a tenant route, which is the reverse
+// proxy (or the maintenance page in its place), checking its type
+func upstreamHandler(route *CaddyRoute, handler string) (int, error) {
+	i := len(route.Handle) - 1
+	if i < 0 || route.Handle[i]["handler"] != handler {
+		return -1, fmt.Errorf("route %s does not end with a %s handler", route.ID, handler)
+	}
+	return i, nil
+}
+
+// MaintenanceOn replaces the reverse proxy of a tenant's route with a static page.
+// The original handler is kept in the inventory, so custom upstreams and timeouts
+// survive. Running it again updates the status and Retry-After.
+func MaintenanceOn(username string, status int, retryAfter time.Duration) error {
+	rec, err := GetTenant(username)
+	if err != nil {
+		return err
+	}
+	if rec == nil {
+		return fmt.Errorf("tenant '%s' is not managed by pilot", username)
+	}
+	if status < 400 || status > 599 {
+		return fmt.Errorf("invalid status %d (must be an error status, e.g. 503)", status)
+	}
+
+	client := NewCaddyClient("")
+	routeID := tenantRouteID(username)
+	route, err := client.GetRoute(routeID)
+	if err != nil {
+		return fmt.Errorf("failed to contact Caddy API: %v (is Caddy running?)", err)
+	}
+	if route == nil {
+		return fmt.Errorf("route %s does not exist (run setup-proxy first)", routeID)
+	}
+
+	m := &MaintenanceMode{Since: time.Now(), Status: status, RetryAfter: int(retryAfter.Seconds())}
+	var i int
+	if rec.Maintenance != nil {
+		m.Since, m.Upstream = rec.Maintenance.Since, rec.Maintenance.Upstream
+		i, err = upstreamHandler(route, "static_response")
+	} else {
+		if i, err = upstreamHandler(route, "reverse_proxy"); err == nil {
+			m.Upstream, err = json.Marshal(route.Handle[i])
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("🚧 Enabling maintenance mode for %s (%d)...\n", username, status)
+	previous := rec.Maintenance
+	if err := UpdateTenant(username, func(t *TenantRecord) { t.Maintenance = m }); err != nil {
+		return fmt.Errorf("failed to update tenant inventory: %v", err)
+	}
+	route.Handle[i] = maintenanceHandler(m, rec.OfflinePage)
+	if err := client.UpdateRoute(*route); err != nil {
+		if stateErr := UpdateTenant(username, func(t *TenantRecord) { t.Maintenance = previous }); stateErr != nil {
+			log.Printf("⚠️  Failed to update tenant inventory: %v", stateErr)
+		}
+		return fmt.Errorf("failed to update route: %v", err)
+	}
+	fmt.Printf("✅ %s now answers with %d.\n", routeID, status)
+	return nil
+}
+
+// MaintenanceOff puts the original reverse proxy of a tenant's route back in place
+func MaintenanceOff(username string) error {
+	rec, err := GetTenant(username)
+	if err != nil {
+		return err
+	}
+	if rec == nil {
+		return fmt.Errorf("tenant '%s' is not managed by pilot", username)
+	}
+	if rec.Maintenance == nil {
+		fmt.Printf("ℹ️  Tenant %s is not in maintenance mode.\n", username)
+		return nil
+	}
+
+	client := NewCaddyClient("")
+	routeID := tenantRouteID(username)
+	route, err := client.GetRoute(routeID)
+	if err != nil {
+		return fmt.Errorf("failed to contact Caddy API: %v (is Caddy running?)", err)
+	}
+	if route == nil {
+		return fmt.Errorf("route %s does not exist (run setup-proxy first)", routeID)
+	}
+	i, err := upstreamHandler(route, "static_response")
+	if err != nil {
+		return err
+	}
+	var upstream map[string]interface{}
+	if err := json.Unmarshal(rec.Maintenance.Upstream, &upstream); err != nil || upstream == nil {
+		return fmt.Errorf("no upstream stored for %s (run setup-proxy to rebuild the route)", username)
+	}
+
+	fmt.Printf("🔌 Disabling maintenance mode for %s...\n", username)
+	route.Handle[i] = upstream
+	if err := client.UpdateRoute(*route); err != nil {
+		return fmt.Errorf("failed to update route: %v", err)
+	}
+	if err := UpdateTenant(username, func(t *TenantRecord) { t.Maintenance = nil }); err != nil {
+		return fmt.Errorf("failed to update tenant inventory: %v", err)
+	}
+	fmt.Printf("✅ %s is served by %s again.\n", routeID, orDash(strings.Join(route.Upstreams(), ",")))
+	return nil
+}
+
+var (
+	mtName       string
+	mtStatus     int
+	mtRetryAfter string
+	mtPageFile   string
+	mtPageReset  bool
+)
+
+var maintenanceCmd = &cobra.Command{
+	Use:   "maintenance",
+	Short: "Puts a tenant's route into or out of maintenance mode",
+}
+
+var maintenanceOnCmd = &cobra.Command{
+	Use:   "on",
+	Short: "Serves a maintenance page instead of proxying to the tenant",
+	Long: `Replaces the reverse proxy of the route tenant-<name> with a static page
+(the tenant's offline page, see 'maintenance page') answered with --status
+(default 503) and a Retry-After header. The tenant's socket is not touched.
+
+The original reverse proxy handler, including custom upstreams and timeouts,
+is kept in the inventory and restored by 'pilot maintenance off'.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		var retryAfter time.Duration
+		if mtRetryAfter != "0" {
+			var err error
+			if retryAfter, err = parseTimeSpan(mtRetryAfter); err != nil {
+				log.Fatalf("❌ Invalid --retry-after: %v", err)
+			}
+		}
+		if err := MaintenanceOn(mtName, mtStatus, retryAfter); err != nil {
+			LogAction("MAINTENANCE_ON", mtName, "FAILED")
+			log.Fatalf("❌ Error: %v", err)
+		}
+		LogAction("MAINTENANCE_ON", mtName, "SUCCESS")
+	},
+}
+
+var maintenanceOffCmd = &cobra.Command{
+	Use:   "off",
+	Short: "Proxies to the tenant again",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := MaintenanceOff(mtName); err != nil {
+			LogAction("MAINTENANCE_OFF", mtName, "FAILED")
+			log.Fatalf("❌ Error: %v", err)
+		}
+		LogAction("MAINTENANCE_OFF", mtName, "SUCCESS")
+	},
+}
+
+var maintenancePageCmd = &cobra.Command{
+	Use:   "page",
+	Short: "Sets the tenant's offline page",
+	Long: `Sets the HTML page shown in maintenance mode and when Caddy cannot reach the
+tenant's socket (502, 503 or 504, served by the error route tenant-<name>-errors).
+With --reset the built-in pages are used again.`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if mtPageReset == (mtPageFile != "") {
+			return fmt.Errorf("specify either --file or --reset")
+		}
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		rec := managedTenant(mtName)
+		var page string
+		if mtPageFile != "" {
+			data, err := os.ReadFile(mtPageFile)
+			if err != nil {
+				log.Fatalf("❌ Failed to read page: %v", err)
+			}
+			page = string(data)
+		}
+		if err := UpdateTenant(rec.Name, func(t *TenantRecord) { t.OfflinePage = page }); err != nil {
+			log.Fatalf("❌ Failed to update tenant inventory: %v", err)
+		}
+		if err := SetupProxy(rec.Name, nil, ""); err != nil {
+			LogAction("MAINTENANCE_PAGE", rec.Name, "FAILED")
+			log.Fatalf("❌ Error: %v", err)
+		}
+		LogAction("MAINTENANCE_PAGE", rec.Name, "SUCCESS")
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(maintenanceCmd)
+	maintenanceCmd.AddCommand(maintenanceOnCmd, maintenanceOffCmd, maintenancePageCmd)
+	for _, c := range []*cobra.Command{maintenanceOnCmd, maintenanceOffCmd, maintenancePageCmd} {
+		c.Flags().StringVarP(&mtName, "name", "n", "", "Tenant Name (Required)")
+		_ = c.MarkFlagRequired("name")
+	}
+	maintenanceOnCmd.Flags().IntVar(&mtStatus, "status", http.StatusServiceUnavailable, "HTTP status of the maintenance page")
+	maintenanceOnCmd.Flags().StringVar(&mtRetryAfter, "retry-after", "5min", "Retry-After sent with the maintenance page (e.g. 10min, 0 to omit)")
+	maintenancePageCmd.Flags().StringVar(&mtPageFile, "file", "", "HTML file with the offline page")
+	maintenancePageCmd.Flags().BoolVar(&mtPageReset, "reset", false, "Use the built-in pages again")
+}
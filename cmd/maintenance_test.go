@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestTenantRouteMaintenance(t *testing.T) {
+	rec := &TenantRecord{
+		Name:        "alice",
+		Proxy:       &ProxyPolicy{Headers: map[string]string{"X-Frame-Options": "DENY"}},
+		Maintenance: &MaintenanceMode{Status: http.StatusServiceUnavailable, RetryAfter: 600},
+	}
+	r := tenantRoute(rec, []string{"alice.localhost"}, "/run/pilot/alice.sock")
+	if len(r.Handle) != 2 || r.Handle[0]["handler"] != "headers" {
+		t.Fatalf("policy handlers were not kept: %v", r.Handle)
+	}
+	page := r.Handle[1]
+	if page["handler"] != "static_response" || page["status_code"] != 503 || page["body"] != defaultMaintenancePage {
+		t.Errorf("unexpected maintenance handler: %v", page)
+	}
+	if h := page["headers"].(map[string][]string); !slices.Equal(h["Retry-After"], []string{"600"}) {
+		t.Errorf("Retry-After = %v", h["Retry-After"])
+	}
+
+	rec.Maintenance, rec.OfflinePage = nil, "<h1>brb</h1>"
+	if r := tenantRoute(rec, []string{"alice.localhost"}, "/run/pilot/alice.sock"); r.Handle[1]["handler"] != "reverse_proxy" {
+		t.Errorf("route without maintenance = %v", r.Handle)
+	}
+	e := errorRoute(rec, []string{"alice.localhost"})
+	if e.ID != "tenant-alice-errors" || e.Match[0].Expression != offlineErrorMatch || e.Handle[0]["body"] != "<h1>brb</h1>" {
+		t.Errorf("unexpected error route: %+v", e)
+	}
+}
+
+// Maintenance mode restores the exact upstream handler, including a custom upstream
+func TestMaintenanceOnOff(t *testing.T) {
+	stateFile = filepath.Join(t.TempDir(), "state.json")
+	defer func() { stateFile = defaultStatePath }()
+	if err := UpdateTenant("alice", func(t *TenantRecord) {}); err != nil {
+		t.Fatal(err)
+	}
+
+	route := buildRoute("tenant-alice", []string{"alice.localhost"}, "localhost:9000", &ProxyPolicy{ResponseTimeout: "30s"})
+	raw, _ := json.Marshal(map[string]interface{}{
+		"apps": map[string]interface{}{"http": map[string]interface{}{"servers": map[string]interface{}{
+			"srv0": map[string]interface{}{"routes": []interface{}{route}},
+		}}},
+	})
+	fake := &fakeCaddy{}
+	json.Unmarshal(raw, &fake.config)
+	original, _ := json.Marshal(fake.config)
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	caddyAdmin = srv.URL
+	defer func() { caddyAdmin = defaultCaddyAdmin }()
+
+	if err := MaintenanceOn("alice", http.StatusServiceUnavailable, 0); err != nil {
+		t.Fatal(err)
+	}
+	got, err := NewCaddyClient("").GetRoute("tenant-alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Handle[0]["handler"] != "static_response" || len(got.Upstreams()) != 0 {
+		t.Errorf("route in maintenance = %v", got.Handle)
+	}
+	if rec, _ := GetTenant("alice"); rec.Maintenance == nil || rec.Maintenance.Upstream == nil {
+		t.Fatalf("maintenance not stored: %+v", rec.Maintenance)
+	}
+
+	if err := MaintenanceOff("alice"); err != nil {
+		t.Fatal(err)
+	}
+	if restored, _ := json.Marshal(fake.config); string(restored) != string(original) {
+		t.Errorf("config after maintenance off:\n%s\nwant\n%s", restored, original)
+	}
+	if rec, _ := GetTenant("alice"); rec.Maintenance != nil {
+		t.Error("maintenance still stored")
+	}
+}
+
+// A custom upstream survives setup-proxy runs without --upstream, in and out of maintenance
+func TestMaintenanceKeepsCustomUpstream(t *testing.T) {
+	stateFile = filepath.Join(t.TempDir(), "state.json")
+	defer func() { stateFile = defaultStatePath }()
+	srv := httptest.NewServer(&fakeCaddy{})
+	defer srv.Close()
+	caddyAdmin = srv.URL
+	defer func() { caddyAdmin = defaultCaddyAdmin }()
+
+	if err := SetupProxy("alice", []string{"alice.localhost"}, "localhost:9000"); err != nil {
+		t.Fatal(err)
+	}
+	if err := MaintenanceOn("alice", http.StatusServiceUnavailable, 0); err != nil {
+		t.Fatal(err)
+	}
+	// e.g. "maintenance page" rebuilding the route
+	if err := SetupProxy("alice", nil, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := MaintenanceOff("alice"); err != nil {
+		t.Fatal(err)
+	}
+	route, err := NewCaddyClient("").GetRoute("tenant-alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := route.Upstreams(); !slices.Equal(got, []string{"localhost:9000"}) {
+		t.Errorf("upstreams after maintenance = %v, want [localhost:9000]", got)
+	}
+
+	// The socket path given explicitly resets the stored upstream
+	if err := SetupProxy("alice", nil, tenantSocketPath("alice")); err != nil {
+		t.Fatal(err)
+	}
+	if rec, _ := GetTenant("alice"); rec.Upstream != "" {
+		t.Errorf("stored upstream = %q, want the default", rec.Upstream)
+	}
+}
@@ -0,0 +1,301 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+// Table in every tenant database that records the applied migrations
+const migrationsTable = "pilot_schema_migrations"
+
+var migrationFileRegex = regexp.MustCompile(`^([0-9]+)_([A-Za-z0-9_.-]+)\.sql$`)
+
+var (
+	migrateDir    string
+	migrateTenant string
+	migrateAll    bool
+)
+
+// Migration is a versioned SQL file (<version>_<description>.sql)
+type Migration struct {
+	Version  int64
+	Name     string // file name
+	SQL      string
+	Checksum string
+}
+
+// MigrationResult is the outcome of migrating one tenant database
+type MigrationResult struct {
+	Tenant  string
+	Applied []string // migrations applied in this run (or that would be, in dry-run mode)
+	Current int64    // highest applied version afterwards
+	Err     error
+}
+
+// loadMigrations reads the migrations of a directory, ordered by version.
+// Files other than *.sql are ignored; a .sql file without a version is an error.
+func loadMigrations(dir string) ([]Migration, error) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations directory: %v", err)
+	}
+
+	var migrations []Migration
+	seen := map[int64]string{}
+	for _, f := range files {
+		if f.IsDir() || filepath.Ext(f.Name()) != ".sql" {
+			continue
+		}
+		m := migrationFileRegex.FindStringSubmatch(f.Name())
+		if m == nil {
+			return nil, fmt.Errorf("invalid migration file name '%s' (expected <version>_<description>.sql)", f.Name())
+		}
+		version, err := strconv.ParseInt(m[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version in '%s': %v", f.Name(), err)
+		}
+		if other, ok := seen[version]; ok {
+			return nil, fmt.Errorf("duplicate migration version %d ('%s' and '%s')", version, other, f.Name())
+		}
+		seen[version] = f.Name()
+
+		content, err := os.ReadFile(filepath.Join(dir, f.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration '%s': %v", f.Name(), err)
+		}
+		sum := sha256.Sum256(content)
+		migrations = append(migrations, Migration{
+			Version:  version,
+			Name:     f.Name(),
+			SQL:      string(content),
+			Checksum: hex.EncodeToString(sum[:]),
+		})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// appliedMigrations returns the checksums of the migrations applied to a database by version.
+// A database without the migrations table has none.
+func appliedMigrations(db *sql.DB) (map[int64]string, error) {
+	var exists bool
+	if err := db.QueryRow("SELECT to_regclass($1) IS NOT NULL", migrationsTable).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("query failed: %v", err)
+	}
+	applied := map[int64]string{}
+	if !exists {
+		return applied, nil
+	}
+
+	rows, err := db.Query("SELECT version, checksum FROM " + migrationsTable)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var version int64
+		var checksum string
+		if err := rows.Scan(&version, &checksum); err != nil {
+			return nil, fmt.Errorf("query failed: %v", err)
+		}
+		applied[version] = checksum
+	}
+	return applied, rows.Err()
+}
+
+// applyMigration runs a migration and records it in one transaction. An advisory lock
+// serializes concurrent runs; a migration applied meanwhile is skipped.
+func applyMigration(db *sql.DB, m Migration) (bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("failed to start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext($1))", "pilot-migrate"); err != nil {
+		return false, fmt.Errorf("failed to lock migrations: %v", err)
+	}
+	if _, err := tx.Exec(`CREATE TABLE IF NOT EXISTS ` + migrationsTable + ` (
+	version    bigint PRIMARY KEY,
+	name       text NOT NULL,
+	checksum   text NOT NULL,
+	applied_at timestamptz NOT NULL DEFAULT now()
+)`); err != nil {
+		return false, fmt.Errorf("failed to create %s: %v", migrationsTable, err)
+	}
+
+	var one int
+	switch err := tx.QueryRow("SELECT 1 FROM "+migrationsTable+" WHERE version = $1", m.Version).Scan(&one); err {
+	case nil:
+		return false, nil
+	case sql.ErrNoRows:
+	default:
+		return false, fmt.Errorf("query failed: %v", err)
+	}
+
+	if _, err := tx.Exec(m.SQL); err != nil {
+		return false, fmt.Errorf("%s: %v", m.Name, err)
+	}
+	if _, err := tx.Exec("INSERT INTO "+migrationsTable+" (version, name, checksum) VALUES ($1, $2, $3)", m.Version, m.Name, m.Checksum); err != nil {
+		return false, fmt.Errorf("failed to record %s: %v", m.Name, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("%s: %v", m.Name, err)
+	}
+	return true, nil
+}
+
+// MigrateTenant applies all pending migrations to a tenant's database, connected
+// as the tenant role (peer authentication), so the tenant owns every object created.
+// It stops at the first failing migration; earlier ones stay applied.
+func MigrateTenant(name string, migrations []Migration) MigrationResult {
+	res := MigrationResult{Tenant: name}
+
+	db, err := openPostgres(name, name)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	defer db.Close()
+
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	for version := range applied {
+		if version > res.Current {
+			res.Current = version
+		}
+	}
+
+	for _, m := range migrations {
+		if checksum, ok := applied[m.Version]; ok {
+			if checksum != m.Checksum {
+				res.Err = fmt.Errorf("%s was modified after it had been applied", m.Name)
+				return res
+			}
+			continue
+		}
+
+		if dryRun {
+			recordChange("sql", fmt.Sprintf("(as %s) apply migration %s", name, m.Name), m.SQL)
+		} else {
+			ok, err := applyMigration(db, m)
+			if err != nil {
+				res.Err = err
+				return res
+			}
+			if !ok {
+				continue
+			}
+		}
+		res.Applied = append(res.Applied, m.Name)
+		if m.Version > res.Current {
+			res.Current = m.Version
+		}
+	}
+	return res
+}
+
+var dbCmd = &cobra.Command{
+	Use:   "db",
+	Short: "Manages the tenant databases",
+}
+
+var dbMigrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Applies versioned SQL migrations to tenant databases",
+	Long: `Applies the SQL files of --dir (<version>_<description>.sql, ordered by version)
+to the database of a single tenant (--tenant) or of every managed tenant (--all).
+
+Migrations run as the tenant role (peer authentication), each in its own
+transaction, and are recorded in the table ` + migrationsTable + ` of every
+database. Applied migrations are skipped; a migration file that was changed after
+it had been applied is reported as an error. A failure stops the migration of that
+tenant, the other tenants are migrated anyway.
+
+With --dry-run the pending migrations are listed per tenant without running them.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if migrateAll == (migrateTenant != "") {
+			log.Fatal("❌ Specify either --tenant or --all")
+		}
+
+		migrations, err := loadMigrations(migrateDir)
+		if err != nil {
+			log.Fatalf("❌ Error: %v", err)
+		}
+		if len(migrations) == 0 {
+			log.Fatalf("❌ No migrations found in %s", migrateDir)
+		}
+
+		st, err := LoadState()
+		if err != nil {
+			log.Fatalf("❌ Error: %v", err)
+		}
+		names := st.Names()
+		if migrateTenant != "" {
+			if st.Tenants[migrateTenant] == nil {
+				log.Fatalf("❌ Tenant '%s' is not managed by pilot", migrateTenant)
+			}
+			names = []string{migrateTenant}
+		}
+
+		LogAction("DB_MIGRATE", migrateTenant, "STARTED")
+		var results []MigrationResult
+		for _, name := range names {
+			fmt.Printf("🐘 Migrating database of '%s'...\n", name)
+			results = append(results, MigrateTenant(name, migrations))
+		}
+
+		if !printMigrationResults(results) {
+			LogAction("DB_MIGRATE", migrateTenant, "FAILED")
+			log.Fatal("⚠️  Some tenants could not be migrated, see above.")
+		}
+		LogAction("DB_MIGRATE", migrateTenant, "SUCCESS")
+	},
+}
+
+// printMigrationResults prints the per-tenant report and whether all tenants succeeded
+func printMigrationResults(results []MigrationResult) bool {
+	fmt.Println()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	applied := "APPLIED"
+	if dryRun {
+		applied = "PENDING"
+	}
+	fmt.Fprintf(w, "TENANT\t%s\tVERSION\tSTATUS\n", applied)
+	fmt.Fprintln(w, "------\t-------\t-------\t------")
+	ok := true
+	for _, r := range results {
+		status := "ok"
+		if r.Err != nil {
+			status = fmt.Sprintf("❌ %v", r.Err)
+			ok = false
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s\n", r.Tenant, len(r.Applied), r.Current, status)
+	}
+	w.Flush()
+	return ok
+}
+
+func init() {
+	rootCmd.AddCommand(dbCmd)
+	dbCmd.AddCommand(dbMigrateCmd)
+	dbMigrateCmd.Flags().StringVar(&migrateDir, "dir", "", "Directory with the migration files")
+	dbMigrateCmd.Flags().StringVar(&migrateTenant, "tenant", "", "Only migrate a single tenant")
+	dbMigrateCmd.Flags().BoolVar(&migrateAll, "all", false, "Migrate every managed tenant")
+	_ = dbMigrateCmd.MarkFlagRequired("dir")
+}
@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeMigrations(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestLoadMigrations(t *testing.T) {
+	dir := writeMigrations(t, map[string]string{
+		"10_add_index.sql":   "CREATE INDEX ...;",
+		"2_create_items.sql": "CREATE TABLE items ();",
+		"001_init.sql":       "CREATE TABLE init ();",
+		"README.md":          "not a migration",
+	})
+
+	migrations, err := loadMigrations(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []int64
+	for _, m := range migrations {
+		got = append(got, m.Version)
+	}
+	if len(got) != 3 || got[0] != 1 || got[1] != 2 || got[2] != 10 {
+		t.Errorf("versions = %v, want [1 2 10]", got)
+	}
+	if migrations[0].Name != "001_init.sql" || len(migrations[0].Checksum) != 64 {
+		t.Errorf("unexpected first migration: %+v", migrations[0])
+	}
+}
+
+func TestLoadMigrationsInvalid(t *testing.T) {
+	for name, files := range map[string]map[string]string{
+		"duplicate": {"1_a.sql": "", "01_b.sql": ""},
+		"unversion": {"init.sql": ""},
+	} {
+		if _, err := loadMigrations(writeMigrations(t, files)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
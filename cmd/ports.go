@@ -0,0 +1,170 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// Default range backend ports are allocated from
+const defaultPortRange = "20000-29999"
+
+// portRange is set by the global --port-range flag
+var portRange = defaultPortRange
+
+// Purposes of allocated ports
+const (
+	PortBackend = "backend"
+)
+
+// PortAllocation records which tenant a port was handed out to
+type PortAllocation struct {
+	Tenant      string    `json:"tenant"`
+	Purpose     string    `json:"purpose"`
+	AllocatedAt time.Time `json:"allocated_at"`
+}
+
+// parsePortRange parses a range like "20000-29999"
+func parsePortRange(s string) (int, int, error) {
+	lo, hi, ok := strings.Cut(s, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid port range '%s' (expected FROM-TO)", s)
+	}
+	from, err1 := strconv.Atoi(strings.TrimSpace(lo))
+	to, err2 := strconv.Atoi(strings.TrimSpace(hi))
+	if err1 != nil || err2 != nil || from < 1024 || to > 65535 || from > to {
+		return 0, 0, fmt.Errorf("invalid port range '%s' (must be within 1024-65535)", s)
+	}
+	return from, to, nil
+}
+
+// portFree reports whether nothing listens on the port on the loopback interface
+func portFree(port int) bool {
+	l, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		return false
+	}
+	l.Close()
+	return true
+}
+
+// allocatedPort returns the port allocated to a tenant for a purpose, or 0
+func (s *State) allocatedPort(tenant, purpose string) int {
+	for port, a := range s.Ports {
+		if a.Tenant == tenant && a.Purpose == purpose {
+			return port
+		}
+	}
+	return 0
+}
+
+// releasePorts drops every allocation of a tenant
+func (s *State) releasePorts(tenant string) {
+	for port, a := range s.Ports {
+		if a.Tenant == tenant {
+			delete(s.Ports, port)
+		}
+	}
+}
+
+// AllocatePort returns the port of a tenant for a purpose, allocating a free one
+// from --port-range on first use. Allocations are persisted in the inventory.
+func AllocatePort(tenant, purpose string) (int, error) {
+	from, to, err := parsePortRange(portRange)
+	if err != nil {
+		return 0, err
+	}
+
+	port := 0
+	err = withStateLock(func(st *State) error {
+		if st.Ports == nil {
+			st.Ports = map[int]*PortAllocation{}
+		}
+		if port = st.allocatedPort(tenant, purpose); port != 0 {
+			return nil
+		}
+
+		// Tenants provisioned before the registry keep their port (UID + 10000),
+		// as long as it lies within the range and nothing else listens on it
+		if rec := st.Tenants[tenant]; purpose == PortBackend && rec != nil && rec.Port >= from && rec.Port <= to && st.Ports[rec.Port] == nil && portFree(rec.Port) {
+			port = rec.Port
+		}
+
+		for p := from; port == 0 && p <= to; p++ {
+			if st.Ports[p] == nil && portFree(p) {
+				port = p
+			}
+		}
+		if port == 0 {
+			return fmt.Errorf("no free port left in range %s", portRange)
+		}
+
+		st.Ports[port] = &PortAllocation{Tenant: tenant, Purpose: purpose, AllocatedAt: time.Now()}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to allocate port for '%s': %v", tenant, err)
+	}
+	return port, nil
+}
+
+// ReleasePort drops the allocation of a tenant's port for a purpose
+func ReleasePort(tenant, purpose string) error {
+	return withStateLock(func(st *State) error {
+		if port := st.allocatedPort(tenant, purpose); port != 0 {
+			delete(st.Ports, port)
+		}
+		return nil
+	})
+}
+
+var portsCmd = &cobra.Command{
+	Use:   "ports",
+	Short: "Lists the allocated ports",
+	Long: `Lists the ports pilot has allocated to tenants, and whether something
+currently listens on them.
+
+Ports are allocated from --port-range (default ` + defaultPortRange + `) when a tenant's
+units are set up, and released when the tenant is deleted.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		st, err := LoadState()
+		if err != nil {
+			log.Fatalf("❌ Error: %v", err)
+		}
+		if len(st.Ports) == 0 {
+			fmt.Println("No ports allocated.")
+			return
+		}
+
+		ports := make([]int, 0, len(st.Ports))
+		for port := range st.Ports {
+			ports = append(ports, port)
+		}
+		sort.Ints(ports)
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+		fmt.Fprintln(w, "PORT\tTENANT\tPURPOSE\tLISTENING\tALLOCATED")
+		fmt.Fprintln(w, "----\t------\t-------\t---------\t---------")
+		for _, port := range ports {
+			a := st.Ports[port]
+			listening := "no"
+			if !portFree(port) {
+				listening = "yes"
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", port, a.Tenant, a.Purpose, listening, a.AllocatedAt.Format("2006-01-02 15:04"))
+		}
+		w.Flush()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(portsCmd)
+}
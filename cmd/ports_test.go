@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"fmt"
+	"net"
+	"path/filepath"
+	"testing"
+)
+
+func TestAllocatePort(t *testing.T) {
+	stateFile = filepath.Join(t.TempDir(), "state.json")
+	defer func() { stateFile = defaultStatePath; portRange = defaultPortRange }()
+
+	// Occupy a port so the allocator has to skip it
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("cannot listen on loopback: %v", err)
+	}
+	defer l.Close()
+	busy := l.Addr().(*net.TCPAddr).Port
+	if busy > 65530 {
+		t.Skipf("ephemeral port %d too close to the end of the range", busy)
+	}
+	portRange = fmt.Sprintf("%d-%d", busy, busy+5)
+
+	alice, err := AllocatePort("alice", PortBackend)
+	if err != nil {
+		t.Fatalf("AllocatePort(alice) error: %v", err)
+	}
+	if alice == busy {
+		t.Errorf("AllocatePort() handed out port %d which is in use", busy)
+	}
+	if again, _ := AllocatePort("alice", PortBackend); again != alice {
+		t.Errorf("AllocatePort() not stable: %d, then %d", alice, again)
+	}
+	bob, err := AllocatePort("bob", PortBackend)
+	if err != nil || bob == alice {
+		t.Fatalf("AllocatePort(bob) = %d, %v; want a port other than %d", bob, err, alice)
+	}
+
+	// Legacy tenants keep the port stored in their record, unless it is out of
+	// range or in use
+	for name, legacy := range map[string]int{"carol": busy + 5, "dave": 11042, "erin": busy} {
+		if err := UpdateTenant(name, func(r *TenantRecord) { r.Port = legacy }); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if carol, _ := AllocatePort("carol", PortBackend); carol != busy+5 {
+		t.Errorf("AllocatePort(carol) = %d, want legacy port %d", carol, busy+5)
+	}
+	if dave, err := AllocatePort("dave", PortBackend); err != nil || dave == 11042 {
+		t.Errorf("AllocatePort(dave) = %d, %v; want a port from the range", dave, err)
+	}
+	if erin, err := AllocatePort("erin", PortBackend); err != nil || erin == busy {
+		t.Errorf("AllocatePort(erin) = %d, %v; want a free port", erin, err)
+	}
+
+	if err := ReleasePort("dave", PortBackend); err != nil {
+		t.Fatal(err)
+	}
+	if st, _ := LoadState(); st.allocatedPort("dave", PortBackend) != 0 || st.Tenants["dave"] == nil {
+		t.Errorf("ReleasePort() = %+v, want dave's port released and the record kept", st.Ports)
+	}
+
+	if err := RemoveTenant("alice"); err != nil {
+		t.Fatal(err)
+	}
+	st, _ := LoadState()
+	if st.allocatedPort("alice", PortBackend) != 0 || st.Ports[bob] == nil {
+		t.Errorf("RemoveTenant() did not release exactly alice's port: %+v", st.Ports)
+	}
+}
+
+func TestParsePortRange(t *testing.T) {
+	for _, bad := range []string{"20000", "30000-20000", "80-90", "20000-70000", "a-b"} {
+		if _, _, err := parsePortRange(bad); err == nil {
+			t.Errorf("parsePortRange(%q) accepted an invalid range", bad)
+		}
+	}
+	if from, to, err := parsePortRange("20000-29999"); err != nil || from != 20000 || to != 29999 {
+		t.Errorf("parsePortRange() = %d, %d, %v", from, to, err)
+	}
+}
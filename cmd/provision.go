@@ -0,0 +1,136 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+// ProvisionStep is a single reversible step of tenant provisioning.
+// Undo is the compensating action and may be nil if the step has nothing to roll back.
+type ProvisionStep struct {
+	Name string
+	Do   func() error
+	Undo func() error
+}
+
+// StepStatus describes what happened to a step during a provisioning run
+type StepStatus string
+
+const (
+	StepSkipped        StepStatus = "skipped"
+	StepDone           StepStatus = "done"
+	StepFailed         StepStatus = "failed"
+	StepRolledBack     StepStatus = "rolled-back"
+	StepRollbackFailed StepStatus = "rollback-failed"
+)
+
+// StepResult records the outcome of a single step
+type StepResult struct {
+	Name   string
+	Status StepStatus
+	Err    error
+}
+
+// RunSteps executes the steps in order. If a step fails, every step that already
+// completed is undone in reverse order. The returned results contain one entry per
+// step, and the error is the one returned by the failing step.
+func RunSteps(steps []ProvisionStep) ([]StepResult, error) {
+	results := make([]StepResult, len(steps))
+	for i, s := range steps {
+		results[i] = StepResult{Name: s.Name, Status: StepSkipped}
+	}
+
+	for i, s := range steps {
+		fmt.Printf("\n▶️  Step %d/%d: %s\n", i+1, len(steps), s.Name)
+		if err := s.Do(); err != nil {
+			results[i].Status = StepFailed
+			results[i].Err = err
+			rollbackSteps(steps[:i], results[:i])
+			return results, fmt.Errorf("step '%s' failed: %v", s.Name, err)
+		}
+		results[i].Status = StepDone
+	}
+
+	return results, nil
+}
+
+// rollbackSteps runs the compensating actions of completed steps in reverse order.
+// A failing Undo does not stop the rollback of earlier steps.
+func rollbackSteps(steps []ProvisionStep, results []StepResult) {
+	for i := len(steps) - 1; i >= 0; i-- {
+		if steps[i].Undo == nil {
+			continue
+		}
+		fmt.Printf("\n↩️  Rolling back: %s\n", steps[i].Name)
+		if err := steps[i].Undo(); err != nil {
+			results[i].Status = StepRollbackFailed
+			results[i].Err = err
+			continue
+		}
+		results[i].Status = StepRolledBack
+	}
+}
+
+// rollbackOutcome splits the completed steps of a failed run into the ones that were
+// rolled back and the ones left behind (not undone or rollback failed)
+func rollbackOutcome(results []StepResult) (undone, leftover []string) {
+	for _, r := range results {
+		switch r.Status {
+		case StepRolledBack:
+			undone = append(undone, r.Name)
+		case StepDone, StepRollbackFailed:
+			leftover = append(leftover, r.Name)
+		}
+	}
+	return undone, leftover
+}
+
+// rolledBack reports whether a failed run left nothing behind
+func rolledBack(results []StepResult) bool {
+	_, leftover := rollbackOutcome(results)
+	return len(leftover) == 0
+}
+
+// rollbackSummary describes the outcome of the rollback of a failed run for the final message
+func rollbackSummary(results []StepResult) string {
+	undone, leftover := rollbackOutcome(results)
+	var parts []string
+	if len(undone) > 0 {
+		parts = append(parts, "rolled back: "+strings.Join(undone, ", "))
+	}
+	if len(leftover) > 0 {
+		parts = append(parts, "NOT rolled back: "+strings.Join(leftover, ", "))
+	}
+	if len(parts) == 0 {
+		return "nothing to roll back"
+	}
+	return strings.Join(parts, "; ")
+}
+
+// recordFailedProvisioning updates the inventory after a failed provisioning run.
+// A new tenant that was rolled back completely is removed again, including its
+// ports; otherwise the record is kept and marked as failed for a later re-run.
+func recordFailedProvisioning(name string, existed bool, results []StepResult) error {
+	if !existed && rolledBack(results) {
+		return RemoveTenant(name)
+	}
+	return UpdateTenant(name, func(t *TenantRecord) { t.Status = TenantFailed })
+}
+
+// printStepReport prints a summary table of a provisioning run
+func printStepReport(results []StepResult) {
+	fmt.Println()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "STEP\tSTATUS\tERROR")
+	fmt.Fprintln(w, "----\t------\t-----")
+	for _, r := range results {
+		errMsg := "-"
+		if r.Err != nil {
+			errMsg = r.Err.Error()
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", r.Name, r.Status, errMsg)
+	}
+	w.Flush()
+}
@@ -0,0 +1,143 @@
+package cmd
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestRunStepsRollback(t *testing.T) {
+	var calls []string
+	step := func(name string, fail bool) ProvisionStep {
+		return ProvisionStep{
+			Name: name,
+			Do: func() error {
+				calls = append(calls, "do:"+name)
+				if fail {
+					return errors.New("boom")
+				}
+				return nil
+			},
+			Undo: func() error {
+				calls = append(calls, "undo:"+name)
+				return nil
+			},
+		}
+	}
+
+	results, err := RunSteps([]ProvisionStep{
+		step("user", false),
+		step("database", false),
+		step("systemd", true),
+		step("proxy", false),
+	})
+	if err == nil {
+		t.Fatal("RunSteps() expected error, got nil")
+	}
+
+	wantCalls := []string{"do:user", "do:database", "do:systemd", "undo:database", "undo:user"}
+	if !reflect.DeepEqual(calls, wantCalls) {
+		t.Errorf("calls = %v, want %v", calls, wantCalls)
+	}
+
+	wantStatus := []StepStatus{StepRolledBack, StepRolledBack, StepFailed, StepSkipped}
+	for i, r := range results {
+		if r.Status != wantStatus[i] {
+			t.Errorf("step %s status = %s, want %s", r.Name, r.Status, wantStatus[i])
+		}
+	}
+}
+
+func TestRunStepsSuccess(t *testing.T) {
+	undone := false
+	results, err := RunSteps([]ProvisionStep{
+		{Name: "a", Do: func() error { return nil }, Undo: func() error { undone = true; return nil }},
+		{Name: "b", Do: func() error { return nil }},
+	})
+	if err != nil {
+		t.Fatalf("RunSteps() unexpected error: %v", err)
+	}
+	if undone {
+		t.Error("Undo was called on a successful run")
+	}
+	for _, r := range results {
+		if r.Status != StepDone {
+			t.Errorf("step %s status = %s, want %s", r.Name, r.Status, StepDone)
+		}
+	}
+}
+
+func TestRecordFailedProvisioning(t *testing.T) {
+	stateFile = filepath.Join(t.TempDir(), "state.json")
+	defer func() { stateFile = defaultStatePath }()
+
+	rolledBackRun := []StepResult{{Name: "user", Status: StepRolledBack}, {Name: "database", Status: StepFailed}, {Name: "systemd", Status: StepSkipped}}
+	leftovers := []StepResult{{Name: "user", Status: StepRollbackFailed}, {Name: "database", Status: StepFailed}}
+
+	tests := []struct {
+		name    string
+		existed bool
+		results []StepResult
+		kept    bool
+	}{
+		{"new tenant rolled back", false, rolledBackRun, false},
+		{"new tenant with leftovers", false, leftovers, true},
+		{"existing tenant rolled back", true, rolledBackRun, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := UpdateTenant("alice", func(r *TenantRecord) {}); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := AllocatePort("alice", PortBackend); err != nil {
+				t.Fatal(err)
+			}
+			if err := recordFailedProvisioning("alice", tt.existed, tt.results); err != nil {
+				t.Fatal(err)
+			}
+
+			st, _ := LoadState()
+			rec := st.Tenants["alice"]
+			switch {
+			case tt.kept && (rec == nil || rec.Status != TenantFailed):
+				t.Errorf("record = %+v, want it kept as %s", rec, TenantFailed)
+			case !tt.kept && (rec != nil || st.allocatedPort("alice", PortBackend) != 0):
+				t.Errorf("record = %+v, ports = %+v; want both removed", rec, st.Ports)
+			}
+		})
+	}
+}
+
+func TestRollbackSummary(t *testing.T) {
+	tests := []struct {
+		name    string
+		results []StepResult
+		want    string
+	}{
+		{"first step failed", []StepResult{{Name: "user", Status: StepFailed}, {Name: "database", Status: StepSkipped}}, "nothing to roll back"},
+		{"rolled back", []StepResult{{Name: "user", Status: StepRolledBack}, {Name: "database", Status: StepRolledBack}, {Name: "systemd", Status: StepFailed}}, "rolled back: user, database"},
+		{"rollback failed", []StepResult{{Name: "user", Status: StepRolledBack}, {Name: "database", Status: StepRollbackFailed}, {Name: "systemd", Status: StepFailed}}, "rolled back: user; NOT rolled back: database"},
+		{"nothing undone", []StepResult{{Name: "user", Status: StepRollbackFailed}, {Name: "database", Status: StepFailed}}, "NOT rolled back: user"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rollbackSummary(tt.results); got != tt.want {
+				t.Errorf("rollbackSummary() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// A failing Undo is reported as left behind
+	results, err := RunSteps([]ProvisionStep{
+		{Name: "user", Do: func() error { return nil }, Undo: func() error { return nil }},
+		{Name: "database", Do: func() error { return nil }, Undo: func() error { return errors.New("in use") }},
+		{Name: "systemd", Do: func() error { return errors.New("boom") }},
+	})
+	if err == nil || rolledBack(results) {
+		t.Fatalf("RunSteps() = %v, rolledBack = %v; want an error and leftovers", err, rolledBack(results))
+	}
+	if got := rollbackSummary(results); got != "rolled back: user; NOT rolled back: database" {
+		t.Errorf("rollbackSummary() = %q", got)
+	}
+}
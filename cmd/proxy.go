@@ -0,0 +1,261 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	proxyRemoveStale bool
+	proxyDomainName  string
+)
+
+var proxyCmd = &cobra.Command{
+	Use:   "proxy",
+	Short: "Inspects and cleans up the Caddy routes",
+}
+
+// routeTenant returns the tenant a route ID belongs to (tenant-<name>)
+func routeTenant(id string) (string, bool) {
+	name, ok := strings.CutPrefix(id, "tenant-")
+	return name, ok && name != ""
+}
+
+// resolveRouteID accepts a route ID or the name of a managed tenant
+func resolveRouteID(st *State, arg string) string {
+	if st.Tenants[arg] != nil {
+		return tenantRouteID(arg)
+	}
+	return arg
+}
+
+var proxyListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Lists the routes of the Caddy server with their domains and upstreams",
+	Long: `Lists every route of the Caddy server (--caddy-server) in the order Caddy evaluates them.
+
+The TENANT column shows the tenant a route belongs to; routes of tenants that
+are not in the inventory (anymore) are marked as stale and can be removed with
+'pilot proxy remove --stale'.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		st, err := LoadState()
+		if err != nil {
+			log.Fatalf("❌ Error: %v", err)
+		}
+		routes, err := NewCaddyClient("").ListRoutes()
+		if err != nil {
+			log.Fatalf("❌ Failed to contact Caddy API: %v (is Caddy running?)", err)
+		}
+		if len(routes) == 0 {
+			fmt.Println("No routes configured.")
+			return
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+		fmt.Fprintln(w, "ID\tHOSTS\tUPSTREAM\tTENANT")
+		fmt.Fprintln(w, "--\t-----\t--------\t------")
+		for _, r := range routes {
+			id, tenant := r.ID, "-"
+			if id == "" {
+				id = "-"
+			}
+			if name, ok := routeTenant(r.ID); ok {
+				tenant = name
+				if st.Tenants[name] == nil {
+					tenant += " (stale)"
+				}
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", id, orDash(strings.Join(r.Hosts(), ",")), orDash(strings.Join(r.Upstreams(), ",")), tenant)
+		}
+		w.Flush()
+	},
+}
+
+var proxyShowCmd = &cobra.Command{
+	Use:   "show <route-id|tenant>",
+	Short: "Prints the JSON of a route",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		st, err := LoadState()
+		if err != nil {
+			log.Fatalf("❌ Error: %v", err)
+		}
+		id := resolveRouteID(st, args[0])
+
+		raw, err := NewCaddyClient("").GetRouteJSON(id)
+		if err != nil {
+			log.Fatalf("❌ Failed to contact Caddy API: %v (is Caddy running?)", err)
+		}
+		if raw == nil {
+			log.Fatalf("❌ Route '%s' does not exist", id)
+		}
+
+		var pretty bytes.Buffer
+		if err := json.Indent(&pretty, raw, "", "  "); err != nil {
+			log.Fatalf("❌ Failed to decode route %s: %v", id, err)
+		}
+		fmt.Println(pretty.String())
+	},
+}
+
+var proxyRemoveCmd = &cobra.Command{
+	Use:   "remove [route-id|tenant]",
+	Short: "Removes a route, or all stale tenant routes",
+	Long: `Removes a route from Caddy by its ID or the name of a managed tenant.
+Removing the route of a managed tenant also updates the inventory.
+
+With --stale every tenant route (tenant-<name>) whose tenant is not in the
+inventory is removed.`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) > 1 || proxyRemoveStale == (len(args) == 1) {
+			return fmt.Errorf("specify either a route ID or --stale")
+		}
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		st, err := LoadState()
+		if err != nil {
+			log.Fatalf("❌ Error: %v", err)
+		}
+
+		var ids []string
+		if proxyRemoveStale {
+			routes, err := NewCaddyClient("").ListRoutes()
+			if err != nil {
+				log.Fatalf("❌ Failed to contact Caddy API: %v (is Caddy running?)", err)
+			}
+			for _, r := range routes {
+				if name, ok := routeTenant(r.ID); ok && st.Tenants[name] == nil {
+					ids = append(ids, r.ID)
+				}
+			}
+			if len(ids) == 0 {
+				fmt.Println("✅ No stale routes found.")
+				return
+			}
+		} else {
+			ids = []string{resolveRouteID(st, args[0])}
+		}
+
+		for _, id := range ids {
+			if err := removeRoute(st, id); err != nil {
+				log.Fatalf("❌ Error: %v", err)
+			}
+		}
+	},
+}
+
+var proxyAddDomainCmd = &cobra.Command{
+	Use:   "add-domain <domain>...",
+	Short: "Adds domains (aliases) to a tenant's route",
+	Long: `Adds domains to the host list of the route tenant-<name> and to the inventory.
+Domains claimed by another tenant or routed by another Caddy route are rejected.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		rec := managedTenant(proxyDomainName)
+		domains := append(slices.Clone(tenantDomains(rec)), args...)
+		if err := SetupProxy(rec.Name, domains, ""); err != nil {
+			LogAction("PROXY_ADD_DOMAIN", rec.Name, "FAILED")
+			log.Fatalf("❌ Error: %v", err)
+		}
+		LogAction("PROXY_ADD_DOMAIN", rec.Name, "SUCCESS")
+	},
+}
+
+var proxyRemoveDomainCmd = &cobra.Command{
+	Use:   "remove-domain <domain>...",
+	Short: "Removes domains from a tenant's route",
+	Long: `Removes domains from the host list of the route tenant-<name> and from the
+inventory. The last domain of a tenant cannot be removed.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		rec := managedTenant(proxyDomainName)
+		domains, err := withoutDomains(tenantDomains(rec), args)
+		if err != nil {
+			log.Fatalf("❌ Error: %v", err)
+		}
+		if err := SetupProxy(rec.Name, domains, ""); err != nil {
+			LogAction("PROXY_REMOVE_DOMAIN", rec.Name, "FAILED")
+			log.Fatalf("❌ Error: %v", err)
+		}
+		LogAction("PROXY_REMOVE_DOMAIN", rec.Name, "SUCCESS")
+	},
+}
+
+// managedTenant returns the inventory record of a tenant or exits
+func managedTenant(name string) *TenantRecord {
+	rec, err := GetTenant(name)
+	if err != nil {
+		log.Fatalf("❌ Error: %v", err)
+	}
+	if rec == nil {
+		log.Fatalf("❌ Tenant '%s' is not managed by pilot", name)
+	}
+	return rec
+}
+
+// withoutDomains removes domains from a host list. Every domain must be on the
+// list, and at least one has to remain.
+func withoutDomains(domains, remove []string) ([]string, error) {
+	remove, err := normalizeDomains(remove)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range remove {
+		if !slices.Contains(domains, d) {
+			return nil, fmt.Errorf("domain '%s' is not routed to this tenant", d)
+		}
+	}
+	var kept []string
+	for _, d := range domains {
+		if !slices.Contains(remove, d) {
+			kept = append(kept, d)
+		}
+	}
+	if len(kept) == 0 {
+		return nil, fmt.Errorf("cannot remove the last domain of a tenant")
+	}
+	return kept, nil
+}
+
+// removeRoute deletes a route. Routes of managed tenants go through RemoveProxy,
+// so the tenant's proxy component is cleared as well.
+func removeRoute(st *State, id string) error {
+	if name, ok := routeTenant(id); ok && st.Tenants[name] != nil {
+		return RemoveProxy(name)
+	}
+
+	client := NewCaddyClient("")
+	exists, err := client.RouteExists(id)
+	if err != nil {
+		return fmt.Errorf("failed to contact Caddy API: %v (is Caddy running?)", err)
+	}
+	if !exists {
+		return fmt.Errorf("route '%s' does not exist", id)
+	}
+	fmt.Printf("🌐 Removing Caddy route %s...\n", id)
+	if err := client.DeleteRoute(id); err != nil {
+		return fmt.Errorf("failed to delete route: %v", err)
+	}
+	LogAction("PROXY_REMOVE", id, "SUCCESS")
+	fmt.Printf("✅ Route %s removed.\n", id)
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(proxyCmd)
+	proxyCmd.AddCommand(proxyListCmd, proxyShowCmd, proxyRemoveCmd, proxyAddDomainCmd, proxyRemoveDomainCmd)
+	for _, c := range []*cobra.Command{proxyAddDomainCmd, proxyRemoveDomainCmd} {
+		c.Flags().StringVarP(&proxyDomainName, "name", "n", "", "Tenant Name")
+		_ = c.MarkFlagRequired("name")
+	}
+	proxyRemoveCmd.Flags().BoolVar(&proxyRemoveStale, "stale", false, "Remove the routes of tenants that are not in the inventory")
+}
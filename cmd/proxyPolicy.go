@@ -0,0 +1,376 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	headerNameRegex = regexp.MustCompile(`^[A-Za-z0-9!#$%&'*+.^_|~-]+$`)
+	rateLimitRegex  = regexp.MustCompile(`^([0-9]+)/([0-9]+(ms|s|m|h))$`)
+)
+
+// ProxyPolicy are the route-level settings of a tenant's Caddy route.
+// Empty fields are not rendered, so the route stays a bare reverse proxy.
+type ProxyPolicy struct {
+	MaxBodySize     string            `json:"max_body_size,omitempty" yaml:"max_body_size"`       // e.g. 10M
+	Headers         map[string]string `json:"headers,omitempty" yaml:"headers"`                   // response headers, e.g. HSTS, CSP
+	BasicAuth       []BasicAuthUser   `json:"basic_auth,omitempty" yaml:"basic_auth"`             // bcrypt-hashed credentials
+	Allow           []string          `json:"allow,omitempty" yaml:"allow"`                       // client IPs/CIDRs, all others get 403
+	Deny            []string          `json:"deny,omitempty" yaml:"deny"`                         // client IPs/CIDRs that get 403
+	DialTimeout     string            `json:"dial_timeout,omitempty" yaml:"dial_timeout"`         // connecting to the socket
+	ResponseTimeout string            `json:"response_timeout,omitempty" yaml:"response_timeout"` // waiting for the response headers
+	// Requests per client IP and window (e.g. 100/1m). Needs a Caddy build with
+	// the rate_limit handler (github.com/mholt/caddy-ratelimit).
+	RateLimit string `json:"rate_limit,omitempty" yaml:"rate_limit"`
+}
+
+// BasicAuthUser is an HTTP basic auth account; only the bcrypt hash of the password is stored
+type BasicAuthUser struct {
+	Username     string `json:"username" yaml:"username"`
+	PasswordHash string `json:"password_hash" yaml:"password_hash"`
+}
+
+// Validate checks every set value against the syntax Caddy accepts
+func (p *ProxyPolicy) Validate() error {
+	if p.MaxBodySize != "" {
+		if _, err := parseByteSize(p.MaxBodySize); err != nil {
+			return err
+		}
+	}
+	for name, value := range p.Headers {
+		if !headerNameRegex.MatchString(name) || value == "" {
+			return fmt.Errorf("invalid header '%s: %s'", name, value)
+		}
+	}
+	seen := map[string]bool{}
+	for _, u := range p.BasicAuth {
+		if u.Username == "" || strings.Contains(u.Username, ":") {
+			return fmt.Errorf("invalid basic auth username '%s'", u.Username)
+		}
+		if seen[u.Username] {
+			return fmt.Errorf("basic auth user '%s' is declared more than once", u.Username)
+		}
+		seen[u.Username] = true
+		if _, err := bcrypt.Cost([]byte(u.PasswordHash)); err != nil {
+			return fmt.Errorf("invalid password hash of basic auth user '%s' (must be bcrypt): %v", u.Username, err)
+		}
+	}
+	for _, r := range append(append([]string{}, p.Allow...), p.Deny...) {
+		if _, _, err := net.ParseCIDR(r); err != nil && net.ParseIP(r) == nil {
+			return fmt.Errorf("invalid IP range '%s' (e.g. 10.0.0.0/8, 2001:db8::1)", r)
+		}
+	}
+	for _, d := range []struct{ name, value string }{{"dial timeout", p.DialTimeout}, {"response timeout", p.ResponseTimeout}} {
+		if d.value == "" {
+			continue
+		}
+		if t, err := time.ParseDuration(d.value); err != nil || t <= 0 {
+			return fmt.Errorf("invalid %s '%s' (e.g. 5s, 2m)", d.name, d.value)
+		}
+	}
+	if p.RateLimit != "" {
+		if m := rateLimitRegex.FindStringSubmatch(p.RateLimit); m == nil || m[1] == "0" {
+			return fmt.Errorf("invalid rate limit '%s' (requests/window, e.g. 100/1m)", p.RateLimit)
+		}
+	}
+	return nil
+}
+
+// IsZero reports whether no policy is set
+func (p *ProxyPolicy) IsZero() bool {
+	return p == nil || (p.MaxBodySize == "" && len(p.Headers) == 0 && len(p.BasicAuth) == 0 &&
+		len(p.Allow) == 0 && len(p.Deny) == 0 && p.DialTimeout == "" && p.ResponseTimeout == "" && p.RateLimit == "")
+}
+
+// Merge returns a copy of p where every field set in update overrides the current value.
+// Headers and basic auth users are merged by name, IP lists are replaced.
+func (p *ProxyPolicy) Merge(update ProxyPolicy) ProxyPolicy {
+	merged := ProxyPolicy{}
+	if p != nil {
+		merged = *p
+	}
+	set := func(dst *string, v string) {
+		if v != "" {
+			*dst = v
+		}
+	}
+	set(&merged.MaxBodySize, update.MaxBodySize)
+	set(&merged.DialTimeout, update.DialTimeout)
+	set(&merged.ResponseTimeout, update.ResponseTimeout)
+	set(&merged.RateLimit, update.RateLimit)
+
+	if len(update.Headers) > 0 {
+		headers := map[string]string{}
+		for k, v := range merged.Headers {
+			headers[k] = v
+		}
+		for k, v := range update.Headers {
+			headers[http.CanonicalHeaderKey(k)] = v
+		}
+		merged.Headers = headers
+	}
+	if len(update.BasicAuth) > 0 {
+		users := append([]BasicAuthUser{}, merged.BasicAuth...)
+	next:
+		for _, u := range update.BasicAuth {
+			for i := range users {
+				if users[i].Username == u.Username {
+					users[i] = u
+					continue next
+				}
+			}
+			users = append(users, u)
+		}
+		merged.BasicAuth = users
+	}
+	if len(update.Allow) > 0 {
+		merged.Allow = update.Allow
+	}
+	if len(update.Deny) > 0 {
+		merged.Deny = update.Deny
+	}
+	return merged
+}
+
+// Handlers renders the policy as the Caddy handlers that run before the reverse
+// proxy, in order: response headers (so they are also set on 401/403 responses),
+// IP filter, rate limit, basic auth, request body limit
+func (p *ProxyPolicy) Handlers() []map[string]interface{} {
+	if p == nil {
+		return nil
+	}
+	var handlers []map[string]interface{}
+
+	if len(p.Headers) > 0 {
+		set := map[string][]string{}
+		for name, value := range p.Headers {
+			set[name] = []string{value}
+		}
+		handlers = append(handlers, map[string]interface{}{
+			"handler":  "headers",
+			"response": map[string]interface{}{"set": set},
+		})
+	}
+
+	// A subroute whose routes do not match passes the request on
+	forbidden := []map[string]interface{}{{"handler": "static_response", "status_code": http.StatusForbidden}}
+	var filters []map[string]interface{}
+	if len(p.Deny) > 0 {
+		filters = append(filters, map[string]interface{}{
+			"match":  []map[string]interface{}{{"remote_ip": map[string]interface{}{"ranges": p.Deny}}},
+			"handle": forbidden,
+		})
+	}
+	if len(p.Allow) > 0 {
+		filters = append(filters, map[string]interface{}{
+			"match":  []map[string]interface{}{{"not": []map[string]interface{}{{"remote_ip": map[string]interface{}{"ranges": p.Allow}}}}},
+			"handle": forbidden,
+		})
+	}
+	if len(filters) > 0 {
+		handlers = append(handlers, map[string]interface{}{"handler": "subroute", "routes": filters})
+	}
+
+	if m := rateLimitRegex.FindStringSubmatch(p.RateLimit); m != nil {
+		events, _ := strconv.Atoi(m[1])
+		handlers = append(handlers, map[string]interface{}{
+			"handler": "rate_limit",
+			"rate_limits": map[string]interface{}{
+				"tenant": map[string]interface{}{
+					"key":        "{http.request.remote.host}",
+					"window":     m[2],
+					"max_events": events,
+				},
+			},
+		})
+	}
+
+	if len(p.BasicAuth) > 0 {
+		var accounts []map[string]string
+		for _, u := range p.BasicAuth {
+			accounts = append(accounts, map[string]string{"username": u.Username, "password": u.PasswordHash})
+		}
+		handlers = append(handlers, map[string]interface{}{
+			"handler": "authentication",
+			"providers": map[string]interface{}{
+				"http_basic": map[string]interface{}{
+					"accounts": accounts,
+					"hash":     map[string]string{"algorithm": "bcrypt"},
+				},
+			},
+		})
+	}
+
+	if size, err := parseByteSize(p.MaxBodySize); err == nil && size > 0 {
+		handlers = append(handlers, map[string]interface{}{"handler": "request_body", "max_size": size})
+	}
+	return handlers
+}
+
+// Transport renders the timeouts as the reverse proxy's HTTP transport, or nil
+func (p *ProxyPolicy) Transport() map[string]interface{} {
+	if p == nil || (p.DialTimeout == "" && p.ResponseTimeout == "") {
+		return nil
+	}
+	transport := map[string]interface{}{"protocol": "http"}
+	if p.DialTimeout != "" {
+		transport["dial_timeout"] = p.DialTimeout
+	}
+	if p.ResponseTimeout != "" {
+		transport["response_header_timeout"] = p.ResponseTimeout
+	}
+	return transport
+}
+
+// parseByteSize parses a size with an optional K, M, G or T suffix (base 1024) into bytes
+func parseByteSize(s string) (int64, error) {
+	if !bytesRegex.MatchString(s) {
+		return 0, fmt.Errorf("invalid size '%s' (e.g. 512K, 10M, 1G)", s)
+	}
+	shift := uint(0)
+	if i := strings.IndexAny(s, "KMGT"); i >= 0 {
+		shift = map[byte]uint{'K': 10, 'M': 20, 'G': 30, 'T': 40}[s[i]]
+		s = s[:i]
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size '%s': %v", s, err)
+	}
+	return n << shift, nil
+}
+
+// proxyPolicyFlags holds the proxy policy flags shared by create-tenant and proxy policy
+type proxyPolicyFlags struct {
+	policy    ProxyPolicy
+	headers   []string
+	basicAuth []string
+}
+
+func addProxyPolicyFlags(cmd *cobra.Command, f *proxyPolicyFlags) {
+	cmd.Flags().StringVar(&f.policy.MaxBodySize, "max-body-size", "", "Maximum request body size (e.g. 10M)")
+	cmd.Flags().StringArrayVar(&f.headers, "header", nil, "Response header 'Name: value' (repeatable, e.g. 'Strict-Transport-Security: max-age=31536000')")
+	cmd.Flags().StringArrayVar(&f.basicAuth, "basic-auth", nil, "Require HTTP basic auth for this user, the password is read from stdin (repeatable, one line each)")
+	cmd.Flags().StringSliceVar(&f.policy.Allow, "allow", nil, "Only allow these client IPs/CIDRs (comma-separated or repeatable)")
+	cmd.Flags().StringSliceVar(&f.policy.Deny, "deny", nil, "Reject these client IPs/CIDRs (comma-separated or repeatable)")
+	cmd.Flags().StringVar(&f.policy.DialTimeout, "dial-timeout", "", "Timeout for connecting to the tenant socket (e.g. 10s)")
+	cmd.Flags().StringVar(&f.policy.ResponseTimeout, "response-timeout", "", "Timeout for the response headers of the tenant (e.g. 60s)")
+	cmd.Flags().StringVar(&f.policy.RateLimit, "rate-limit", "", "Requests per client IP and window, needs the caddy-ratelimit module (e.g. 100/1m)")
+}
+
+// spec builds the policy from the flags. Basic auth passwords are read from stdin,
+// one line per --basic-auth user, and hashed with bcrypt.
+func (f *proxyPolicyFlags) spec(stdin io.Reader) (ProxyPolicy, error) {
+	p := f.policy
+	for _, h := range f.headers {
+		name, value, ok := strings.Cut(h, ":")
+		if !ok {
+			return p, fmt.Errorf("invalid --header '%s' (expected 'Name: value')", h)
+		}
+		if p.Headers == nil {
+			p.Headers = map[string]string{}
+		}
+		p.Headers[http.CanonicalHeaderKey(strings.TrimSpace(name))] = strings.TrimSpace(value)
+	}
+
+	if len(f.basicAuth) > 0 {
+		scanner := bufio.NewScanner(stdin)
+		for _, username := range f.basicAuth {
+			fmt.Fprintf(os.Stderr, "🔑 Password for basic auth user '%s': ", username)
+			if !scanner.Scan() {
+				return p, fmt.Errorf("no password given for basic auth user '%s'", username)
+			}
+			password := strings.TrimRight(scanner.Text(), "\r")
+			if password == "" {
+				return p, fmt.Errorf("empty password for basic auth user '%s'", username)
+			}
+			hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+			if err != nil {
+				return p, fmt.Errorf("failed to hash password of '%s': %v", username, err)
+			}
+			p.BasicAuth = append(p.BasicAuth, BasicAuthUser{Username: username, PasswordHash: string(hash)})
+		}
+		fmt.Fprintln(os.Stderr)
+	}
+	return p, p.Validate()
+}
+
+// SetTenantProxyPolicy merges the given policy into the tenant's stored proxy policy
+func SetTenantProxyPolicy(username string, update ProxyPolicy, reset bool) error {
+	if err := update.Validate(); err != nil {
+		return err
+	}
+	err := UpdateTenant(username, func(t *TenantRecord) {
+		current := t.Proxy
+		if reset {
+			current = nil
+		}
+		merged := current.Merge(update)
+		t.Proxy = &merged
+		if t.Proxy.IsZero() {
+			t.Proxy = nil
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update tenant inventory: %v", err)
+	}
+	return nil
+}
+
+var (
+	ppName   string
+	ppReset  bool
+	ppPolicy proxyPolicyFlags
+)
+
+var proxyPolicyCmd = &cobra.Command{
+	Use:   "policy",
+	Short: "Updates the proxy policy of a tenant's route",
+	Long: `Updates the route-level policy of a tenant: request body size limit,
+response headers, HTTP basic auth, IP allow/deny lists, timeouts and rate limit.
+
+The policy is stored in the inventory and the route tenant-<name> is rebuilt
+with the matching Caddy handlers in front of the reverse proxy.
+Basic auth passwords are read from stdin and only their bcrypt hash is stored.
+
+Only the given settings are changed; use --reset to drop all others.
+
+Example:
+  echo "s3cret" | pilot proxy policy --name="omar" --basic-auth=admin \
+    --header="Strict-Transport-Security: max-age=31536000" --max-body-size=10M`,
+	Run: func(cmd *cobra.Command, args []string) {
+		policy, err := ppPolicy.spec(os.Stdin)
+		if err != nil {
+			log.Fatalf("❌ Invalid proxy policy: %v", err)
+		}
+		rec := managedTenant(ppName)
+		if err := SetTenantProxyPolicy(rec.Name, policy, ppReset); err != nil {
+			log.Fatalf("❌ Error: %v", err)
+		}
+		if err := SetupProxy(rec.Name, nil, ""); err != nil {
+			LogAction("PROXY_POLICY", rec.Name, "FAILED")
+			log.Fatalf("❌ Error: %v", err)
+		}
+		LogAction("PROXY_POLICY", rec.Name, "SUCCESS")
+	},
+}
+
+func init() {
+	proxyCmd.AddCommand(proxyPolicyCmd)
+	proxyPolicyCmd.Flags().StringVarP(&ppName, "name", "n", "", "Tenant Name (Required)")
+	proxyPolicyCmd.Flags().BoolVar(&ppReset, "reset", false, "Remove all policy settings that are not given on the command line")
+	addProxyPolicyFlags(proxyPolicyCmd, &ppPolicy)
+	_ = proxyPolicyCmd.MarkFlagRequired("name")
+}
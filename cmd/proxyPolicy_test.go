@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestProxyPolicyValidate(t *testing.T) {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("s3cret"), bcrypt.MinCost)
+	valid := ProxyPolicy{
+		MaxBodySize:     "10M",
+		Headers:         map[string]string{"Strict-Transport-Security": "max-age=31536000"},
+		BasicAuth:       []BasicAuthUser{{Username: "admin", PasswordHash: string(hash)}},
+		Allow:           []string{"10.0.0.0/8", "2001:db8::1"},
+		DialTimeout:     "10s",
+		ResponseTimeout: "2m",
+		RateLimit:       "100/1m",
+	}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("Validate() = %v", err)
+	}
+
+	for _, p := range []ProxyPolicy{
+		{MaxBodySize: "10MB"},
+		{Headers: map[string]string{"Bad Header": "x"}},
+		{BasicAuth: []BasicAuthUser{{Username: "admin", PasswordHash: "s3cret"}}},
+		{Deny: []string{"10.0.0.0/33"}},
+		{ResponseTimeout: "60"},
+		{RateLimit: "0/1m"},
+	} {
+		if err := p.Validate(); err == nil {
+			t.Errorf("Validate(%+v) accepted an invalid policy", p)
+		}
+	}
+}
+
+func TestProxyPolicyMerge(t *testing.T) {
+	current := &ProxyPolicy{
+		MaxBodySize: "1M",
+		Headers:     map[string]string{"X-Frame-Options": "DENY"},
+		BasicAuth:   []BasicAuthUser{{Username: "admin", PasswordHash: "old"}},
+		Allow:       []string{"10.0.0.0/8"},
+	}
+	merged := current.Merge(ProxyPolicy{
+		Headers:   map[string]string{"content-security-policy": "default-src 'self'"},
+		BasicAuth: []BasicAuthUser{{Username: "admin", PasswordHash: "new"}, {Username: "ops", PasswordHash: "x"}},
+	})
+	if merged.MaxBodySize != "1M" || len(merged.Allow) != 1 {
+		t.Errorf("unset fields were changed: %+v", merged)
+	}
+	if merged.Headers["X-Frame-Options"] != "DENY" || merged.Headers["Content-Security-Policy"] == "" {
+		t.Errorf("headers = %v", merged.Headers)
+	}
+	if len(merged.BasicAuth) != 2 || merged.BasicAuth[0].PasswordHash != "new" {
+		t.Errorf("basic auth = %+v", merged.BasicAuth)
+	}
+	if current.Headers["Content-Security-Policy"] != "" {
+		t.Error("Merge modified the current policy")
+	}
+}
+
+func TestBuildRouteWithPolicy(t *testing.T) {
+	policy := &ProxyPolicy{
+		MaxBodySize:     "1K",
+		Headers:         map[string]string{"Strict-Transport-Security": "max-age=31536000"},
+		BasicAuth:       []BasicAuthUser{{Username: "admin", PasswordHash: "$2a$04$hash"}},
+		Deny:            []string{"192.0.2.0/24"},
+		ResponseTimeout: "30s",
+	}
+	r := buildRoute("tenant-alice", []string{"alice.localhost"}, "/run/pilot/alice.sock", policy)
+
+	var handlers []string
+	for _, h := range r.Handle {
+		handlers = append(handlers, h["handler"].(string))
+	}
+	if got := strings.Join(handlers, ","); got != "headers,subroute,authentication,request_body,reverse_proxy" {
+		t.Errorf("handler chain = %s", got)
+	}
+	if size := r.Handle[3]["max_size"]; size != int64(1024) {
+		t.Errorf("max_size = %v, want 1024", size)
+	}
+	if transport, _ := r.Handle[4]["transport"].(map[string]interface{}); transport["response_header_timeout"] != "30s" {
+		t.Errorf("transport = %v", r.Handle[4]["transport"])
+	}
+	if got := r.Upstreams(); len(got) != 1 || got[0] != "unix//run/pilot/alice.sock" {
+		t.Errorf("Upstreams() = %v", got)
+	}
+
+	if bare := buildRoute("tenant-bob", []string{"bob.localhost"}, "/run/pilot/bob.sock", &ProxyPolicy{}); len(bare.Handle) != 1 {
+		t.Errorf("empty policy produced %d handlers, want 1", len(bare.Handle))
+	}
+}
+
+// Passwords are read from stdin and only their hash is kept
+func TestProxyPolicyFlagsSpec(t *testing.T) {
+	f := proxyPolicyFlags{
+		headers:   []string{"x-robots-tag: noindex"},
+		basicAuth: []string{"admin", "ops"},
+	}
+	p, err := f.spec(strings.NewReader("s3cret\nother\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Headers["X-Robots-Tag"] != "noindex" {
+		t.Errorf("headers = %v", p.Headers)
+	}
+	if len(p.BasicAuth) != 2 || bcrypt.CompareHashAndPassword([]byte(p.BasicAuth[1].PasswordHash), []byte("other")) != nil {
+		t.Errorf("basic auth = %+v", p.BasicAuth)
+	}
+
+	if _, err := f.spec(strings.NewReader("s3cret\n")); err == nil {
+		t.Error("a missing password was accepted")
+	}
+}
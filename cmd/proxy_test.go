@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestNormalizeDomains(t *testing.T) {
+	got, err := normalizeDomains([]string{"Example.com", "www.example.com.", "example.com", "*.example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"example.com", "www.example.com", "*.example.com"}; !slices.Equal(got, want) {
+		t.Errorf("normalizeDomains() = %v, want %v", got, want)
+	}
+
+	for _, bad := range []string{"", "exa mple.com", "-example.com", "example..com", "a/b"} {
+		if _, err := normalizeDomains([]string{bad}); err == nil {
+			t.Errorf("normalizeDomains(%q) should fail", bad)
+		}
+	}
+}
+
+func TestDomainConflicts(t *testing.T) {
+	st := &State{Tenants: map[string]*TenantRecord{
+		"alice": {Name: "alice", Domains: []string{"alice.example.com", "www.alice.example.com"}},
+		"bob":   {Name: "bob", Domains: []string{"bob.example.com"}},
+	}}
+	routes := []CaddyRoute{
+		buildRoute("tenant-alice", []string{"alice.example.com"}, "/run/pilot/alice.sock", nil),
+		buildRoute("static", []string{"static.example.com"}, "localhost:8080", nil),
+	}
+
+	tests := []struct {
+		tenant  string
+		domain  string
+		wantErr bool
+	}{
+		{"alice", "alice.example.com", false}, // own route and inventory entry
+		{"alice", "new.example.com", false},
+		{"bob", "www.alice.example.com", true}, // claimed in the inventory
+		{"bob", "alice.example.com", true},
+		{"bob", "static.example.com", true}, // routed by an unmanaged route
+	}
+	for _, tt := range tests {
+		err := domainConflicts(tt.tenant, []string{tt.domain}, st, routes)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("domainConflicts(%s, %s) error = %v, wantErr %v", tt.tenant, tt.domain, err, tt.wantErr)
+		}
+	}
+}
+
+func TestWithoutDomains(t *testing.T) {
+	domains := []string{"example.com", "www.example.com"}
+	got, err := withoutDomains(domains, []string{"WWW.example.com"})
+	if err != nil || !slices.Equal(got, []string{"example.com"}) {
+		t.Errorf("withoutDomains() = %v, %v", got, err)
+	}
+	if _, err := withoutDomains(domains, []string{"other.com"}); err == nil {
+		t.Error("removing an unknown domain should fail")
+	}
+	if _, err := withoutDomains(domains, domains); err == nil {
+		t.Error("removing every domain should fail")
+	}
+}
+
+// On a fresh Caddy without any config, the domain check must not trip over the
+// missing HTTP app before the server is created
+func TestSetupProxyEmptyCaddy(t *testing.T) {
+	stateFile = filepath.Join(t.TempDir(), "state.json")
+	defer func() { stateFile = defaultStatePath }()
+	fake := &fakeCaddy{}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	caddyAdmin = srv.URL
+	defer func() { caddyAdmin = defaultCaddyAdmin }()
+
+	if routes, err := NewCaddyClient("").ListRoutes(); err != nil || routes != nil {
+		t.Fatalf("ListRoutes() = %v, %v; want no routes", routes, err)
+	}
+	if err := SetupProxy("alice", []string{"alice.localhost"}, ""); err != nil {
+		t.Fatal(err)
+	}
+	route, err := NewCaddyClient("").GetRoute(tenantRouteID("alice"))
+	if err != nil || route == nil {
+		t.Fatalf("GetRoute() = %v, %v; want the tenant route", route, err)
+	}
+}
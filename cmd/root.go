@@ -3,6 +3,7 @@ package cmd
 import (
 	"log"
 	"os"
+	"strings"
 
 	"github.com/spf13/cobra"
 )
@@ -39,6 +40,9 @@ systemd Socket Activation on Linux systems.
 It automates the complex configuration of Linux users, systemd units, 
 PostgreSQL database roles, and Caddy reverse proxy routes to enable 
 resource-efficient, lazy-loaded web service provisioning.`,
+	PersistentPostRun: func(cmd *cobra.Command, args []string) {
+		printDryRunSummary()
+	},
 	// Uncomment the following line if your bare application
 	// has an action associated with it:
 	// Run: func(cmd *cobra.Command, args []string) { },
@@ -59,8 +63,30 @@ func init() {
 	// will be global for your application.
 
 	// rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.pilot.yaml)")
+	rootCmd.PersistentFlags().BoolVar(&dryRun, "dry-run", false, "Print the commands, files and API calls that would be applied without executing them")
+	rootCmd.PersistentFlags().StringVar(&stateFile, "state", defaultStatePath, "Path to the tenant inventory")
+	rootCmd.PersistentFlags().StringVar(&portRange, "port-range", defaultPortRange, "Range backend ports are allocated from (FROM-TO)")
+	rootCmd.PersistentFlags().StringVar(&caddyAdmin, "caddy-admin", envOr("PILOT_CADDY_ADMIN", defaultCaddyAdmin), "Caddy admin API address (host:port, URL or unix//path/to/admin.sock)")
+	rootCmd.PersistentFlags().StringVar(&caddyServer, "caddy-server", envOr("PILOT_CADDY_SERVER", defaultCaddyServer), "Name of the Caddy HTTP server that holds the tenant routes")
+	rootCmd.PersistentFlags().StringSliceVar(&caddyListen, "caddy-listen", envListOr("PILOT_CADDY_LISTEN", defaultCaddyListen), "Listen addresses of the Caddy server")
 
 	// Cobra also supports local flags, which will only run
 	// when this action is called directly.
 	rootCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
 }
+
+// envOr returns the value of an environment variable, or def if it is unset or empty
+func envOr(name, def string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return def
+}
+
+// envListOr is envOr for comma-separated lists
+func envListOr(name string, def []string) []string {
+	if v := os.Getenv(name); v != "" {
+		return strings.Split(v, ",")
+	}
+	return def
+}
@@ -2,8 +2,7 @@ package cmd
 
 import (
 	"fmt"
-	"os/exec"
-	"strings"
+	"log"
 )
 
 // SetupDatabase creates a PostgreSQL user and database for the tenant
@@ -15,39 +14,98 @@ func SetupDatabase(username string) error {
 
 	fmt.Printf("🐘 Configuring PostgreSQL for %s...\n", username)
 
-	// 1. Check if role exists
-	// We use "sudo -u postgres psql -tAc ..." to check safely.
-	checkCmd := exec.Command("sudo", "-u", "postgres", "psql", "-tAc", fmt.Sprintf("SELECT 1 FROM pg_roles WHERE rolname='%s'", username))
-	out, _ := checkCmd.CombinedOutput()
-	outputStr := strings.TrimSpace(string(out))
-
-	if outputStr != "1" {
-		// 2. Create Role
-		fmt.Printf("   ➕ Creating DB Role '%s'...\n", username)
-		createRoleCmd := exec.Command("sudo", "-u", "postgres", "createuser", "-S", "-R", "-D", "-l", username)
-		if out, err := createRoleCmd.CombinedOutput(); err != nil {
-			return fmt.Errorf("failed to create db user: %v, output: %s", err, string(out))
-		}
+	// 1. Create Role (unless it exists)
+	roleCreated, err := createRole(username)
+	if err != nil {
+		return fmt.Errorf("failed to create db user: %v", err)
+	}
+	if roleCreated {
+		fmt.Printf("   ➕ Created DB Role '%s'.\n", username)
 	} else {
 		fmt.Printf("   ℹ️  DB Role '%s' already exists.\n", username)
 	}
 
-	// 3. Check if Database exists
-	checkDbCmd := exec.Command("sudo", "-u", "postgres", "psql", "-tAc", fmt.Sprintf("SELECT 1 FROM pg_database WHERE datname='%s'", username))
-	out, _ = checkDbCmd.CombinedOutput()
-	outputStr = strings.TrimSpace(string(out))
+	// 2. Check if Database exists
+	exists, err := databaseExists(username)
+	if err != nil {
+		return err
+	}
 
-	if outputStr != "1" {
-		// 4. Create Database
+	if !exists {
+		// 3. Create Database
 		fmt.Printf("   ➕ Creating Database '%s'...\n", username)
-		createDbCmd := exec.Command("sudo", "-u", "postgres", "createdb", "-O", username, username)
-		if out, err := createDbCmd.CombinedOutput(); err != nil {
-			return fmt.Errorf("failed to create database: %v, output: %s", err, string(out))
+		if err := createDatabase(username); err != nil {
+			// Don't leave a role behind that only this run created
+			if roleCreated {
+				if dropErr := dropRole(username); dropErr != nil {
+					log.Printf("⚠️  Failed to drop role '%s' again: %v", username, dropErr)
+				}
+			}
+			return fmt.Errorf("failed to create database: %v", err)
 		}
 		fmt.Printf("✅ Database ready.\n")
 	} else {
 		fmt.Printf("   ℹ️  Database '%s' already exists.\n", username)
 	}
 
+	// 4. Connection limit and role settings as stored in the inventory
+	rec, err := GetTenant(username)
+	if err != nil {
+		return err
+	}
+	var limits *DatabaseLimits
+	if rec != nil {
+		limits = rec.DBLimits
+	}
+	if err := applyDBLimits(username, limits); err != nil {
+		return err
+	}
+
+	return recordComponent(username, ComponentDatabase, StepDone, nil)
+}
+
+// DropDatabase removes the tenant's PostgreSQL database and role.
+// Missing objects are skipped, so it can be used on partially provisioned tenants.
+func DropDatabase(username string) error {
+	// 0. Validate Username
+	if err := ValidateUsername(username); err != nil {
+		return fmt.Errorf("security check failed: %v", err)
+	}
+
+	fmt.Printf("🐘 Removing PostgreSQL objects for %s...\n", username)
+
+	// 1. Drop Database (must happen before the role, which owns it)
+	exists, err := databaseExists(username)
+	if err != nil {
+		return err
+	}
+	if exists {
+		fmt.Printf("   ➖ Dropping Database '%s'...\n", username)
+		if err := dropDatabase(username); err != nil {
+			return fmt.Errorf("failed to drop database: %v", err)
+		}
+	} else {
+		fmt.Printf("   ℹ️  Database '%s' does not exist.\n", username)
+	}
+
+	// 2. Drop Role
+	exists, err = roleExists(username)
+	if err != nil {
+		return err
+	}
+	if exists {
+		fmt.Printf("   ➖ Dropping DB Role '%s'...\n", username)
+		if err := dropRole(username); err != nil {
+			return fmt.Errorf("failed to drop db user: %v", err)
+		}
+	} else {
+		fmt.Printf("   ℹ️  DB Role '%s' does not exist.\n", username)
+	}
+
+	if err := clearComponent(username, ComponentDatabase); err != nil {
+		return err
+	}
+
+	fmt.Printf("✅ Database removed.\n")
 	return nil
 }
@@ -6,10 +6,22 @@ import (
 	"github.com/spf13/cobra"
 )
 
+var setupDbLimits DatabaseLimits
+
 var setupDbCmd = &cobra.Command{
 	Use:   "setup-database",
 	Short: "Configures PostgreSQL user and database",
+	Long: `Creates the tenant's PostgreSQL role and database (peer authentication).
+
+Database limits (--db-connection-limit, --db-statement-timeout,
+--db-idle-in-transaction-timeout, --db-work-mem, --db-size-quota) are merged
+into the tenant's stored limits and applied to its role.`,
 	Run: func(cmd *cobra.Command, args []string) {
+		if !setupDbLimits.IsZero() {
+			if err := SetTenantDBLimits(setupTenantName, setupDbLimits, false); err != nil {
+				log.Fatalf("❌ Error: %v", err)
+			}
+		}
 		if err := SetupDatabase(setupTenantName); err != nil {
 			log.Fatalf("❌ Error: %v", err)
 		}
@@ -19,5 +31,6 @@ var setupDbCmd = &cobra.Command{
 func init() {
 	rootCmd.AddCommand(setupDbCmd)
 	setupDbCmd.Flags().StringVarP(&setupTenantName, "name", "n", "", "Tenant Name")
+	addDBLimitFlags(setupDbCmd, &setupDbLimits)
 	_ = setupDbCmd.MarkFlagRequired("name")
 }
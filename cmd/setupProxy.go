@@ -1,82 +1,249 @@
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
 	"log"
+	"regexp"
+	"slices"
+	"strings"
 
 	"github.com/spf13/cobra"
 )
 
+var domainRegex = regexp.MustCompile(`^(\*\.)?([a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?\.)*[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
 // Flags
 var proxyTenantName string
-var proxyDomain string
+var proxyDomains []string
 var proxyUpstream string // Optional: allow manual upstream override
 
 var setupProxyCmd = &cobra.Command{
 	Use:   "setup-proxy",
-	Short: "Configures Caddy to route a domain to the tenant's socket",
+	Short: "Configures Caddy to route the tenant's domains to its socket",
+	Long: `Creates or updates the Caddy route tenant-<name>, which sends every domain
+of the tenant (--domain, repeatable: apex, www, aliases) to its socket.
+Without --domain the domains stored in the inventory are used. --upstream is
+stored as well, so later runs (domain changes, policies, drift repair) keep it.
+
+A domain that is already claimed by another tenant, or routed by another
+Caddy route, is rejected.
+
+The tenant's proxy policy (see 'pilot proxy policy') is applied to the route,
+and an error route serves the tenant's offline page when its socket is unreachable.
+During maintenance mode the route keeps serving the maintenance page.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		if err := SetupProxy(proxyTenantName, proxyDomain, proxyUpstream); err != nil {
+		if err := SetupProxy(proxyTenantName, proxyDomains, proxyUpstream); err != nil {
 			log.Fatal(err)
 		}
 	},
 }
 
 // SetupProxy configures Caddy for a user via the REST API
-func SetupProxy(username, domain, upstream string) error {
-	// 1. Determine Domain
-	if domain == "" {
-		domain = fmt.Sprintf("%s.localhost", username)
+func SetupProxy(username string, domains []string, upstream string) error {
+	rec, err := GetTenant(username)
+	if err != nil {
+		return err
+	}
+	if rec == nil {
+		rec = &TenantRecord{Name: username}
+	}
+
+	// 1. Determine Domains (explicit flags > inventory > default)
+	if len(domains) == 0 {
+		domains = tenantDomains(rec)
+	}
+	domains, err = normalizeDomains(domains)
+	if err != nil {
+		return err
+	}
+	if err := checkDomainConflicts(username, domains); err != nil {
+		return err
 	}
 
-	// 2. Determine Upstream
-	if upstream == "" {
-		// Default to Unix socket
-		upstream = fmt.Sprintf("/run/pilot/%s.sock", username)
+	// 2. Determine Upstream (explicit flag > inventory > Unix socket)
+	explicit := upstream != ""
+	if !explicit {
+		upstream = tenantUpstream(rec)
 	}
 
-	routeID := fmt.Sprintf("tenant-%s", username)
-	fmt.Printf("🌐 Configuring Caddy via API: %s -> %s\n", domain, upstream)
+	routeID := tenantRouteID(username)
+	fmt.Printf("🌐 Configuring Caddy via API: %s -> %s\n", strings.Join(domains, ", "), upstream)
+
+	client := NewCaddyClient("")
 
-	client := NewCaddyClient("") // Use default localhost:2019
+	// 3. Make sure the server exists, without touching other servers, routes or apps
+	if err := client.EnsureServer(); err != nil {
+		return fmt.Errorf("failed to prepare Caddy server '%s': %v (is Caddy running?)", client.Server, err)
+	}
 
-	// 3. Check if route exists
 	exists, err := client.RouteExists(routeID)
 	if err != nil {
 		return fmt.Errorf("failed to contact Caddy API: %v (is Caddy running?)", err)
 	}
 
+	route := tenantRoute(rec, domains, upstream)
 	if exists {
 		// Update
 		fmt.Printf("🔄 Updating existing route %s...\n", routeID)
-		if err := client.UpdateRoute(routeID, domain, upstream); err != nil {
+		if err := client.UpdateRoute(route); err != nil {
 			return fmt.Errorf("failed to update route: %v", err)
 		}
 	} else {
 		// Create
 		fmt.Printf("➕ Adding new route %s...\n", routeID)
-		if err := client.AddRoute(routeID, domain, upstream); err != nil {
-			// Retry with Init check
-			fmt.Println("⚠️  Route addition failed, attempting to initialize Caddy server 'srv0'...")
-			if initErr := client.InitServer(); initErr != nil {
-				return fmt.Errorf("failed to init server: %v (original error: %v)", initErr, err)
-			}
+		if err := client.AddRoute(route); err != nil {
+			return fmt.Errorf("caddy API error (create): %v", err)
+		}
+	}
+
+	// Friendly page instead of a raw 502 when the socket is unreachable
+	if err := client.SetErrorRoute(errorRoute(rec, domains)); err != nil {
+		return fmt.Errorf("failed to configure error page: %v", err)
+	}
 
-			fmt.Println("🔄 Retrying route addition...")
-			if retryErr := client.AddRoute(routeID, domain, upstream); retryErr != nil {
-				return fmt.Errorf("caddy API error (create): %v", retryErr)
+	// 4. HTTPS: certificates per domain (ACME or internal CA), HTTP is redirected
+	fmt.Println("🔒 Configuring TLS policies...")
+	if err := client.EnableHTTPS(); err != nil {
+		return fmt.Errorf("failed to enable HTTPS on %s: %v", client.Server, err)
+	}
+	if err := syncTLSPolicies(client, username, domains); err != nil {
+		return err
+	}
+
+	if err := recordComponent(username, ComponentProxy, StepDone, func(t *TenantRecord) {
+		t.Domains = domains
+		if explicit {
+			t.Upstream = upstream
+			if upstream == tenantSocketPath(username) {
+				t.Upstream = ""
 			}
 		}
+		if t.Maintenance != nil {
+			// Restored by "maintenance off" instead of the handler stored when it was enabled
+			handlers := buildRoute(routeID, domains, upstream, rec.Proxy).Handle
+			t.Maintenance.Upstream, _ = json.Marshal(handlers[len(handlers)-1])
+		}
+	}); err != nil {
+		return err
+	}
+
+	fmt.Printf("✅ Success! You can now access https://%s\n", domains[0])
+	return nil
+}
+
+// RemoveProxy deletes the tenant's route and TLS policies from Caddy via the REST API.
+// A missing route is not an error, so it can be used on partially provisioned tenants.
+func RemoveProxy(username string) error {
+	routeID := tenantRouteID(username)
+	fmt.Printf("🌐 Removing Caddy route %s...\n", routeID)
+
+	client := NewCaddyClient("")
+
+	exists, err := client.RouteExists(routeID)
+	if err != nil {
+		return fmt.Errorf("failed to contact Caddy API: %v (is Caddy running?)", err)
+	}
+	if exists {
+		if err := client.DeleteRoute(routeID); err != nil {
+			return fmt.Errorf("failed to delete route: %v", err)
+		}
+	} else {
+		fmt.Printf("   ℹ️  Route %s does not exist.\n", routeID)
+	}
+
+	if err := removeErrorRoute(client, username); err != nil {
+		return err
+	}
+	if err := removeTLSPolicies(client, username); err != nil {
+		return err
+	}
+
+	if err := clearComponent(username, ComponentProxy); err != nil {
+		return err
+	}
+
+	if exists {
+		fmt.Printf("✅ Route %s removed.\n", routeID)
+	}
+	return nil
+}
+
+// normalizeDomains lower-cases the domains, drops duplicates (keeping the order,
+// the first domain is the primary one) and rejects invalid host names
+func normalizeDomains(domains []string) ([]string, error) {
+	var result []string
+	seen := map[string]bool{}
+	for _, d := range domains {
+		d = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(d)), ".")
+		if len(d) > 253 || !domainRegex.MatchString(d) {
+			return nil, fmt.Errorf("invalid domain '%s'", d)
+		}
+		if !seen[d] {
+			seen[d] = true
+			result = append(result, d)
+		}
 	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("at least one domain is required")
+	}
+	return result, nil
+}
 
-	fmt.Printf("✅ Success! You can now access http://%s\n", domain)
+// checkDomainConflicts rejects domains that another tenant claims in the inventory
+// or that another Caddy route already matches
+func checkDomainConflicts(username string, domains []string) error {
+	st, err := LoadState()
+	if err != nil {
+		return err
+	}
+	routes, err := NewCaddyClient("").ListRoutes()
+	if err != nil {
+		return fmt.Errorf("failed to contact Caddy API: %v (is Caddy running?)", err)
+	}
+	return domainConflicts(username, domains, st, routes)
+}
+
+// domainConflicts is checkDomainConflicts on a given inventory and route list
+func domainConflicts(username string, domains []string, st *State, routes []CaddyRoute) error {
+	for _, d := range domains {
+		for _, name := range st.Names() {
+			if name != username && slices.Contains(st.Tenants[name].Domains, d) {
+				return fmt.Errorf("domain '%s' is already claimed by tenant '%s'", d, name)
+			}
+		}
+		for _, r := range routes {
+			if r.ID != tenantRouteID(username) && slices.Contains(r.Hosts(), d) {
+				return fmt.Errorf("domain '%s' is already routed by Caddy route '%s'", d, orDash(r.ID))
+			}
+		}
+	}
 	return nil
 }
 
+// tenantRouteID is the Caddy @id of a tenant's route
+func tenantRouteID(username string) string {
+	return fmt.Sprintf("tenant-%s", username)
+}
+
+// tenantSocketPath is the public socket systemd listens on for a tenant
+func tenantSocketPath(username string) string {
+	return fmt.Sprintf("/run/pilot/%s.sock", username)
+}
+
+// tenantUpstream is where a tenant's route proxies to: the upstream given to
+// setup-proxy --upstream, or the tenant's socket
+func tenantUpstream(rec *TenantRecord) string {
+	if rec.Upstream != "" {
+		return rec.Upstream
+	}
+	return tenantSocketPath(rec.Name)
+}
+
 func init() {
 	rootCmd.AddCommand(setupProxyCmd)
 	setupProxyCmd.Flags().StringVarP(&proxyTenantName, "name", "n", "", "Tenant Name (Required)")
-	setupProxyCmd.Flags().StringVarP(&proxyDomain, "domain", "d", "", "Custom Domain (e.g. app.example.com)")
-	setupProxyCmd.Flags().StringVarP(&proxyUpstream, "upstream", "u", "", "Custom Upstream (e.g. localhost:8080 or /run/foo.sock)")
+	setupProxyCmd.Flags().StringSliceVarP(&proxyDomains, "domain", "d", nil, "Domain of the tenant route, repeatable for aliases (e.g. app.example.com)")
+	setupProxyCmd.Flags().StringVarP(&proxyUpstream, "upstream", "u", "", "Custom Upstream (e.g. localhost:8080 or /run/foo.sock), default: stored upstream or the tenant's socket")
 	_ = setupProxyCmd.MarkFlagRequired("name")
 }
@@ -7,7 +7,7 @@ import (
 	"os"
 	"os/user"
 	"path/filepath"
-	"strconv"
+	"strings"
 	"text/template"
 
 	"github.com/spf13/cobra"
@@ -17,18 +17,47 @@ import (
 type SystemdConfig struct {
 	Username string
 	UID      string
-	Port     string
+	HomeDir  string
+	Port     int
 	IdleTime string
+
+	// Direct activation (see ActivationDirect): the socket starts the backend itself,
+	// which exits after IdleTimeout (a Go duration) without connections
+	Direct      bool
+	IdleTimeout string
+
+	// Application (see AppSpec)
+	ExecStart  string
+	WorkingDir string
+	Env        []string
+
+	// Resource control directives (see ResourceLimits)
+	Limits []string
+
+	// Sandboxing directives of the hardening profile
+	Hardening []string
 }
 
-// 1. SOCKET: Listens on the file, triggers the proxy
+// setApp fills in the application fields of the config (nil selects the default app)
+func (c *SystemdConfig) setApp(app *AppSpec) {
+	app = appOrDefault(app)
+	c.ExecStart = app.ExecStart()
+	c.WorkingDir = strings.ReplaceAll(app.WorkingDir, "%", "%%")
+	c.Env = app.Environment()
+}
+
+// 1. SOCKET: Listens on the file, triggers the proxy (or the backend in direct mode)
 const socketTmpl = `[Unit]
 Description=Public Socket for {{.Username}}
 
 [Socket]
 ListenStream=/run/pilot/{{.Username}}.sock
 SocketMode=0666
+{{- if .Direct}}
+Service=rest-api.service
+{{- else}}
 Service=rest-api-proxy.service
+{{- end}}
 
 [Install]
 WantedBy=sockets.target
@@ -50,25 +79,96 @@ NonBlocking=true
 
 // 3. BACKEND: The "Dumb" Worker
 // StopWhenUnneeded=true: Dies automatically when the proxy dies
+// In direct mode it inherits the socket (LISTEN_FDS) and exits on its own after IDLE_TIMEOUT
 const serviceTmpl = `[Unit]
 Description=User REST API Backend
+{{- if not .Direct}}
 StopWhenUnneeded=true
 PartOf=rest-api-proxy.service
+{{- end}}
 
 [Service]
-ExecStart=/usr/local/bin/user-rest-api
+ExecStart={{.ExecStart}}
+{{- if .WorkingDir}}
+WorkingDirectory={{.WorkingDir}}
+{{- end}}
+{{- if .Direct}}
+Environment=IDLE_TIMEOUT={{.IdleTimeout}}
+{{- else}}
 Environment=PORT={{.Port}}
+{{- end}}
+{{- range .Env}}
+Environment={{.}}
+{{- end}}
 Type=simple
+{{- if not .Direct}}
 ExecStartPost=/bin/sleep 1
+{{- end}}
+{{- if .Hardening}}
+
+# Sandboxing (hardening profile)
+{{- range .Hardening}}
+{{.}}
+{{- end}}
+{{- end}}
 `
 
+// User-scope units generated by SetupSystemd
+var tenantUnits = []string{"rest-api.socket", "rest-api-proxy.service", "rest-api.service"}
+
+// Every file SetupSystemd writes, relative to ~/.config/systemd/user
+var unitFiles = []string{"rest-api.socket", "rest-api-proxy.service", "rest-api.service", limitsDropIn}
+
 var setupTenantName string
 var setupIdleTime string
+var setupApp appFlags
+var setupLimits ResourceLimits
+var setupHardening string
+var setupActivation string
 
 var setupSystemdCmd = &cobra.Command{
 	Use:   "setup-systemd",
 	Short: "Sets up autoscaling systemd units",
+	Long: `Generates the socket, proxy and backend units for a tenant and enables the socket.
+
+The backend runs the tenant's application. Use --app (binary or full command line),
+--app-arg, --workdir and --env to set it; without these flags the application stored
+in the inventory is kept (default: ` + defaultAppCommand + `).
+
+Resource limits (--memory-max, --cpu-quota, ...) are merged into the tenant's stored
+limits and rendered into the drop-in ` + limitsDropIn + `.
+
+--hardening selects the sandboxing profile of the backend (none, default, strict).
+
+--activation selects how the socket reaches the backend:
+  proxy   rest-api.socket -> systemd-socket-proxyd -> 127.0.0.1:PORT (default, works with every app)
+  direct  rest-api.socket passes its fd to the backend (LISTEN_FDS), which must
+          exit by itself after IDLE_TIMEOUT without connections`,
 	Run: func(cmd *cobra.Command, args []string) {
+		app, err := setupApp.spec()
+		if err != nil {
+			log.Fatalf("❌ Error: %v", err)
+		}
+		if app != nil {
+			if err := SetTenantApp(setupTenantName, app); err != nil {
+				log.Fatalf("❌ Error: %v", err)
+			}
+		}
+		if !setupLimits.IsZero() {
+			if err := SetTenantLimits(setupTenantName, setupLimits, false); err != nil {
+				log.Fatalf("❌ Error: %v", err)
+			}
+		}
+		if setupHardening != "" {
+			if err := SetTenantHardening(setupTenantName, setupHardening); err != nil {
+				log.Fatalf("❌ Error: %v", err)
+			}
+		}
+		if setupActivation != "" {
+			if err := SetTenantActivation(setupTenantName, setupActivation); err != nil {
+				log.Fatalf("❌ Error: %v", err)
+			}
+		}
 		if err := SetupSystemd(setupTenantName, setupIdleTime); err != nil {
 			log.Fatalf("❌ Error: %v", err)
 		}
@@ -77,77 +177,257 @@ var setupSystemdCmd = &cobra.Command{
 
 // SetupSystemd configures the systemd units for a user
 func SetupSystemd(username, idleTime string) error {
-	u, err := user.Lookup(username)
+	// The proxy forwards to a TCP port, direct activation needs none
+	rec, err := GetTenant(username)
 	if err != nil {
-		return fmt.Errorf("could not find user %s: %v", username, err)
+		return err
 	}
-
-	// Calculate a high port based on UID (e.g., UID + 10000)
-	// This avoids "permission denied" on ports < 1024
-	uidInt, err := strconv.Atoi(u.Uid)
-	if err != nil {
-		return fmt.Errorf("invalid UID %s: %v", u.Uid, err)
+	if rec == nil || activationOrDefault(rec.Activation) == ActivationProxy {
+		if _, err := AllocatePort(username, PortBackend); err != nil {
+			return err
+		}
 	}
-	port := uidInt + 10000
 
-	config := SystemdConfig{
-		Username: username,
-		UID:      u.Uid,
-		Port:     fmt.Sprintf("%d", port),
-		IdleTime: idleTime,
+	config, err := tenantSystemdConfig(username, idleTime)
+	if err != nil {
+		return err
 	}
 
 	// Ensure shared socket directory exists and is writable
-	socketDir := "/run/pilot"
-	if err := os.MkdirAll(socketDir, 0777); err != nil {
-		return fmt.Errorf("failed to create socket directory %s: %v", socketDir, err)
-	}
-	// Force permissions (MkdirAll respects umask)
-	if err := os.Chmod(socketDir, 0777); err != nil {
-		return fmt.Errorf("failed to chmod socket directory %s: %v", socketDir, err)
+	if err := makeDir("/run/pilot", 0777); err != nil {
+		return err
 	}
 
 	fmt.Printf("🔧 Configuring Autoscaling (Idle: %s) for %s...\n", config.IdleTime, config.Username)
 
 	// Render Templates
-	socketContent, err := renderTemplate("socket", socketTmpl, config)
+	units, err := renderUnits(config)
 	if err != nil {
 		return err
 	}
-	proxyContent, err := renderTemplate("proxy", proxyTmpl, config)
-	if err != nil {
+
+	// Write Files
+	systemdDir := filepath.Join(config.HomeDir, ".config/systemd/user")
+	dataDir := filepath.Join(config.HomeDir, tenantDataDir)
+	if err := runAsUser(config.Username, "mkdir", "-p", systemdDir, filepath.Join(systemdDir, filepath.Dir(limitsDropIn)), dataDir); err != nil {
 		return err
 	}
-	serviceContent, err := renderTemplate("service", serviceTmpl, config)
+
+	manager, err := ConnectUserManager(config.Username)
 	if err != nil {
 		return err
 	}
+	defer manager.Close()
 
-	// Write Files
-	systemdDir := filepath.Join(u.HomeDir, ".config/systemd/user")
-	if err := runAsUser(config.Username, "mkdir", "-p", systemdDir); err != nil {
-		return err
+	for _, name := range unitFiles {
+		path := filepath.Join(systemdDir, name)
+		content, wanted := units[name]
+		if wanted {
+			if err := writeAsUser(config.Username, content, path); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// Unit of the other activation mode, e.g. the proxy after switching to direct
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		if err := manager.Stop(name); err != nil {
+			return err
+		}
+		if err := removeFile(path); err != nil {
+			return err
+		}
 	}
 
-	if err := writeAsUser(config.Username, socketContent, filepath.Join(systemdDir, "rest-api.socket")); err != nil {
+	// Reload & Enable only the Socket
+	if err := manager.DaemonReload(); err != nil {
 		return err
 	}
-	if err := writeAsUser(config.Username, proxyContent, filepath.Join(systemdDir, "rest-api-proxy.service")); err != nil {
+	if err := manager.Enable("rest-api.socket"); err != nil {
 		return err
 	}
-	if err := writeAsUser(config.Username, serviceContent, filepath.Join(systemdDir, "rest-api.service")); err != nil {
+	if err := manager.Start("rest-api.socket"); err != nil {
 		return err
 	}
 
-	// Reload & Enable only the Socket
-	if err := runAsUser(config.Username, "systemctl", "--user", "daemon-reload"); err != nil {
+	if err := recordComponent(username, ComponentSystemd, StepDone, func(t *TenantRecord) {
+		t.UID = config.UID
+		t.Port = config.Port
+		t.IdleTime = idleTime
+	}); err != nil {
+		return err
+	}
+
+	fmt.Println("✅ Autoscaling Active. Service will die after", config.IdleTime, "of silence.")
+	return nil
+}
+
+// setDirect switches the config to direct activation
+func (c *SystemdConfig) setDirect(idleTime string) error {
+	idle, err := parseTimeSpan(idleTime)
+	if err != nil {
+		return fmt.Errorf("invalid idle time: %v", err)
+	}
+	c.Direct = true
+	c.IdleTimeout = idle.String()
+	return nil
+}
+
+// tenantSystemdConfig resolves everything the unit templates need for a tenant
+func tenantSystemdConfig(username, idleTime string) (SystemdConfig, error) {
+	u, err := lookupTenantUser(username)
+	if err != nil {
+		return SystemdConfig{}, fmt.Errorf("could not find user %s: %v", username, err)
+	}
+
+	// Backend port from the port registry (see AllocatePort); tenants set up
+	// before the registry existed still carry their port in the record
+	st, err := LoadState()
+	if err != nil {
+		return SystemdConfig{}, err
+	}
+	rec := st.Tenants[username]
+	port := st.allocatedPort(username, PortBackend)
+	if port == 0 && rec != nil {
+		port = rec.Port
+	}
+
+	config := SystemdConfig{
+		Username: username,
+		UID:      u.Uid,
+		HomeDir:  u.HomeDir,
+		Port:     port,
+		IdleTime: idleTime,
+	}
+
+	if rec != nil && activationOrDefault(rec.Activation) == ActivationDirect {
+		if err := config.setDirect(idleTime); err != nil {
+			return SystemdConfig{}, err
+		}
+	}
+
+	// Application as stored in the inventory
+	var app *AppSpec
+	if rec != nil {
+		app = rec.App
+	}
+	config.setApp(app)
+	hardening := ""
+	if rec != nil {
+		config.Limits = rec.Limits.Directives()
+		hardening = rec.Hardening
+	}
+	config.Hardening = hardeningDirectives(hardening, u.HomeDir)
+
+	return config, nil
+}
+
+// renderUnits renders the unit templates of the tenant's activation mode, keyed by unit file name.
+// Files of unitFiles that are missing from the result must not exist.
+func renderUnits(config SystemdConfig) (map[string]string, error) {
+	templates := map[string]string{
+		"rest-api.socket":        socketTmpl,
+		"rest-api-proxy.service": proxyTmpl,
+		"rest-api.service":       serviceTmpl,
+		limitsDropIn:             limitsTmpl,
+	}
+	if config.Direct {
+		delete(templates, "rest-api-proxy.service")
+	}
+
+	units := make(map[string]string, len(templates))
+	for name, tmpl := range templates {
+		content, err := renderTemplate(name, tmpl, config)
+		if err != nil {
+			return nil, err
+		}
+		units[name] = content
+	}
+	return units, nil
+}
+
+// readUnits reads the tenant's unit files from disk, keyed by unit file name.
+// Missing files are returned as empty strings.
+func readUnits(homeDir string) (map[string]string, error) {
+	systemdDir := filepath.Join(homeDir, ".config/systemd/user")
+	units := make(map[string]string, len(unitFiles))
+	for _, name := range unitFiles {
+		content, err := os.ReadFile(filepath.Join(systemdDir, name))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to read unit %s: %v", name, err)
+		}
+		units[name] = string(content)
+	}
+	return units, nil
+}
+
+// TeardownSystemd stops and removes the systemd units created by SetupSystemd.
+// Missing users, units or user managers are skipped, so it can be used on partially provisioned tenants.
+func TeardownSystemd(username string) error {
+	u, err := user.Lookup(username)
+	if err != nil {
+		fmt.Printf("   ℹ️  User '%s' does not exist, no units to remove.\n", username)
+		return nil
+	}
+
+	fmt.Printf("🔧 Removing systemd units for %s...\n", username)
+
+	systemdDir := filepath.Join(u.HomeDir, ".config/systemd/user")
+
+	// Only talk to the user manager if it is actually running
+	var manager *UserManager
+	if _, err := os.Stat(fmt.Sprintf("/run/user/%s/bus", u.Uid)); err == nil {
+		if manager, err = ConnectUserManager(username); err != nil {
+			return err
+		}
+		defer manager.Close()
+	}
+
+	if manager != nil {
+		if _, err := os.Stat(filepath.Join(systemdDir, "rest-api.socket")); err == nil {
+			if err := manager.Stop("rest-api.socket"); err != nil {
+				return err
+			}
+			if err := manager.Disable("rest-api.socket"); err != nil {
+				return err
+			}
+		}
+		// Units that are not loaded are skipped, so this is safe to run unconditionally
+		if err := manager.Stop("rest-api-proxy.service", "rest-api.service"); err != nil {
+			return err
+		}
+	} else {
+		fmt.Printf("   ℹ️  User manager for '%s' is not running, skipping systemctl.\n", username)
+	}
+
+	// Remove unit files (the drop-in directory last, once it is empty)
+	for _, name := range unitFiles {
+		if err := removeFile(filepath.Join(systemdDir, name)); err != nil {
+			return err
+		}
+	}
+	if err := removeFile(filepath.Join(systemdDir, filepath.Dir(limitsDropIn))); err != nil {
+		return err
+	}
+
+	if manager != nil {
+		if err := manager.DaemonReload(); err != nil {
+			return err
+		}
+	}
+
+	// Remove the public socket (systemd normally cleans it up, but not if the manager is gone)
+	if err := removeFile(tenantSocketPath(username)); err != nil {
 		return err
 	}
-	if err := runAsUser(config.Username, "systemctl", "--user", "enable", "--now", "rest-api.socket"); err != nil {
+
+	if err := clearComponent(username, ComponentSystemd); err != nil {
 		return err
 	}
 
-	fmt.Println("✅ Autoscaling Active. Service will die after", config.IdleTime, "of silence.")
+	fmt.Println("✅ Systemd units removed.")
 	return nil
 }
 
@@ -171,5 +451,9 @@ func init() {
 	setupSystemdCmd.Flags().StringVarP(&setupTenantName, "name", "n", "", "Tenant Name")
 	// Default to 5 minutes, but allowing "10s" is great for demos/testing
 	setupSystemdCmd.Flags().StringVarP(&setupIdleTime, "idle", "i", "5min", "Time before service dies (e.g. 10s, 5min)")
+	addAppFlags(setupSystemdCmd, &setupApp)
+	addLimitFlags(setupSystemdCmd, &setupLimits)
+	setupSystemdCmd.Flags().StringVar(&setupActivation, "activation", "", "Socket activation mode: proxy, direct (default: keep stored mode)")
+	setupSystemdCmd.Flags().StringVar(&setupHardening, "hardening", "", "Sandboxing profile of the backend: none, default, strict (default: keep stored profile)")
 	_ = setupSystemdCmd.MarkFlagRequired("name")
 }
@@ -0,0 +1,257 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"syscall"
+	"time"
+)
+
+// Default location of the tenant inventory
+const defaultStatePath = "/var/lib/pilot/state.json"
+
+// stateFile is set by the global --state flag
+var stateFile = defaultStatePath
+
+// dryRunState holds the inventory as it would look after the recorded changes,
+// so later steps of a dry-run see what earlier steps would have written
+var dryRunState *State
+
+// Tenant provisioning components, used as keys in TenantRecord.Components
+const (
+	ComponentUser     = "user"
+	ComponentDatabase = "database"
+	ComponentSystemd  = "systemd"
+	ComponentProxy    = "proxy"
+)
+
+// Overall tenant status
+const (
+	TenantProvisioning = "provisioning"
+	TenantReady        = "ready"
+	TenantFailed       = "failed"
+)
+
+// TenantRecord is everything pilot knows about a tenant it manages
+type TenantRecord struct {
+	Name        string                `json:"name"`
+	UID         string                `json:"uid,omitempty"`
+	Port        int                   `json:"port,omitempty"`
+	Domains     []string              `json:"domains,omitempty"`
+	IdleTime    string                `json:"idle_time,omitempty"`
+	CreatedAt   time.Time             `json:"created_at"`
+	UpdatedAt   time.Time             `json:"updated_at"`
+	Status      string                `json:"status"`
+	Components  map[string]StepStatus `json:"components,omitempty"`
+	App         *AppSpec              `json:"app,omitempty"`
+	Limits      *ResourceLimits       `json:"limits,omitempty"`
+	Hardening   string                `json:"hardening,omitempty"`
+	Activation  string                `json:"activation,omitempty"`
+	DBLimits    *DatabaseLimits       `json:"db_limits,omitempty"`
+	Proxy       *ProxyPolicy          `json:"proxy,omitempty"`
+	Upstream    string                `json:"upstream,omitempty"` // custom upstream of setup-proxy --upstream, empty for the socket
+	Maintenance *MaintenanceMode      `json:"maintenance,omitempty"`
+	OfflinePage string                `json:"offline_page,omitempty"` // custom HTML of the maintenance and error page
+}
+
+// State is the on-disk tenant inventory
+type State struct {
+	Tenants map[string]*TenantRecord `json:"tenants"`
+	Ports   map[int]*PortAllocation  `json:"ports,omitempty"`
+}
+
+// LoadState reads the inventory from the state file.
+// A missing file yields an empty inventory.
+func LoadState() (*State, error) {
+	if dryRun && dryRunState != nil {
+		return dryRunState, nil
+	}
+
+	st := &State{Tenants: map[string]*TenantRecord{}}
+
+	data, err := os.ReadFile(stateFile)
+	if os.IsNotExist(err) {
+		return st, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state file %s: %v", stateFile, err)
+	}
+
+	if err := json.Unmarshal(data, st); err != nil {
+		return nil, fmt.Errorf("failed to parse state file %s: %v", stateFile, err)
+	}
+	if st.Tenants == nil {
+		st.Tenants = map[string]*TenantRecord{}
+	}
+	return st, nil
+}
+
+// Save atomically writes the inventory to the state file
+func (s *State) Save() error {
+	// The inventory describes the host, which is left untouched in dry-run mode
+	if dryRun {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(stateFile), 0755); err != nil {
+		return fmt.Errorf("failed to create state directory: %v", err)
+	}
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write to a temp file first so a crash never leaves a truncated inventory
+	tmp := stateFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write state file %s: %v", tmp, err)
+	}
+	if err := os.Rename(tmp, stateFile); err != nil {
+		return fmt.Errorf("failed to replace state file %s: %v", stateFile, err)
+	}
+	return nil
+}
+
+// Names returns the tenant names in alphabetical order
+func (s *State) Names() []string {
+	names := make([]string, 0, len(s.Tenants))
+	for name := range s.Tenants {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// GetTenant returns the record of a tenant, or nil if pilot does not manage it
+func GetTenant(name string) (*TenantRecord, error) {
+	st, err := LoadState()
+	if err != nil {
+		return nil, err
+	}
+	return st.Tenants[name], nil
+}
+
+// UpdateTenant loads the inventory, applies fn to the tenant's record (creating it
+// if needed) and saves the result. The state file is locked for the whole cycle.
+func UpdateTenant(name string, fn func(t *TenantRecord)) error {
+	return withStateLock(func(st *State) error {
+		t, ok := st.Tenants[name]
+		if !ok {
+			t = &TenantRecord{
+				Name:       name,
+				CreatedAt:  time.Now(),
+				Status:     TenantProvisioning,
+				Components: map[string]StepStatus{},
+			}
+			st.Tenants[name] = t
+		}
+		if t.Components == nil {
+			t.Components = map[string]StepStatus{}
+		}
+		fn(t)
+		t.UpdatedAt = time.Now()
+		return nil
+	})
+}
+
+// RemoveTenant deletes a tenant's record from the inventory and releases its ports
+func RemoveTenant(name string) error {
+	return withStateLock(func(st *State) error {
+		delete(st.Tenants, name)
+		st.releasePorts(name)
+		return nil
+	})
+}
+
+// recordComponent marks a provisioning component of a tenant with the given status
+func recordComponent(name, component string, status StepStatus, fn func(t *TenantRecord)) error {
+	err := UpdateTenant(name, func(t *TenantRecord) {
+		t.Components[component] = status
+		if fn != nil {
+			fn(t)
+		}
+		if t.allComponentsDone() {
+			t.Status = TenantReady
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update tenant inventory: %v", err)
+	}
+	return nil
+}
+
+// clearComponent removes a component from a tenant's record after it was torn down.
+// Tenants that are not in the inventory are left alone.
+func clearComponent(name, component string) error {
+	return withStateLock(func(st *State) error {
+		if t, ok := st.Tenants[name]; ok {
+			delete(t.Components, component)
+			t.UpdatedAt = time.Now()
+		}
+		return nil
+	})
+}
+
+// allComponentsDone reports whether every provisioning component completed
+func (t *TenantRecord) allComponentsDone() bool {
+	for _, c := range []string{ComponentUser, ComponentDatabase, ComponentSystemd, ComponentProxy} {
+		if t.Components[c] != StepDone {
+			return false
+		}
+	}
+	return true
+}
+
+// withStateLock serializes read-modify-write cycles of concurrent pilot invocations
+func withStateLock(fn func(st *State) error) error {
+	if dryRun {
+		st, err := LoadState()
+		if err != nil {
+			return err
+		}
+		if err := fn(st); err != nil {
+			return err
+		}
+		dryRunState = st
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(stateFile), 0755); err != nil {
+		return fmt.Errorf("failed to create state directory: %v", err)
+	}
+
+	unlock, err := lockFile(stateFile + ".lock")
+	if err != nil {
+		return fmt.Errorf("failed to lock state file: %v", err)
+	}
+	defer unlock()
+
+	st, err := LoadState()
+	if err != nil {
+		return err
+	}
+	if err := fn(st); err != nil {
+		return err
+	}
+	return st.Save()
+}
+
+// lockFile takes an exclusive flock on path (created if missing) and returns the unlock function
+func lockFile(path string) (func(), error) {
+	lock, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(lock.Fd()), syscall.LOCK_EX); err != nil {
+		lock.Close()
+		return nil, err
+	}
+	return func() {
+		syscall.Flock(int(lock.Fd()), syscall.LOCK_UN)
+		lock.Close()
+	}, nil
+}
@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestStateRoundTrip(t *testing.T) {
+	stateFile = filepath.Join(t.TempDir(), "state.json")
+	defer func() { stateFile = defaultStatePath }()
+
+	for _, c := range []string{ComponentUser, ComponentDatabase, ComponentSystemd} {
+		if err := recordComponent("alice", c, StepDone, nil); err != nil {
+			t.Fatalf("recordComponent(%s) error: %v", c, err)
+		}
+	}
+
+	rec, err := GetTenant("alice")
+	if err != nil {
+		t.Fatalf("GetTenant() error: %v", err)
+	}
+	if rec == nil || rec.Status != TenantProvisioning {
+		t.Fatalf("GetTenant() = %+v, want status %s", rec, TenantProvisioning)
+	}
+
+	if err := recordComponent("alice", ComponentProxy, StepDone, func(t *TenantRecord) {
+		t.Domains = []string{"alice.localhost"}
+	}); err != nil {
+		t.Fatalf("recordComponent(proxy) error: %v", err)
+	}
+
+	rec, _ = GetTenant("alice")
+	if rec.Status != TenantReady {
+		t.Errorf("status = %s, want %s", rec.Status, TenantReady)
+	}
+	if len(rec.Domains) != 1 || rec.Domains[0] != "alice.localhost" {
+		t.Errorf("domains = %v, want [alice.localhost]", rec.Domains)
+	}
+
+	if err := clearComponent("alice", ComponentProxy); err != nil {
+		t.Fatalf("clearComponent() error: %v", err)
+	}
+	if err := clearComponent("bob", ComponentProxy); err != nil {
+		t.Fatalf("clearComponent() on unknown tenant error: %v", err)
+	}
+
+	st, err := LoadState()
+	if err != nil {
+		t.Fatalf("LoadState() error: %v", err)
+	}
+	if _, ok := st.Tenants["bob"]; ok {
+		t.Error("clearComponent() created a record for an unknown tenant")
+	}
+	if _, ok := st.Tenants["alice"].Components[ComponentProxy]; ok {
+		t.Error("clearComponent() did not remove the proxy component")
+	}
+
+	if err := RemoveTenant("alice"); err != nil {
+		t.Fatalf("RemoveTenant() error: %v", err)
+	}
+	if rec, _ := GetTenant("alice"); rec != nil {
+		t.Errorf("GetTenant() after RemoveTenant = %+v, want nil", rec)
+	}
+}
@@ -0,0 +1,248 @@
+package cmd
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// httpsProbeAddr is the local address the served certificates are inspected at:
+// the first HTTPS listen address of the server, on the loopback interface
+func httpsProbeAddr(listen []string) string {
+	port := "443"
+	host := "127.0.0.1"
+	if len(listen) > 0 {
+		if h, p, err := net.SplitHostPort(strings.TrimPrefix(listen[0], "tcp/")); err == nil {
+			port = p
+			if ip := net.ParseIP(h); h != "" && (ip == nil || !ip.IsUnspecified()) {
+				host = h
+			}
+		}
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// TLS issuers of tenant domains
+const (
+	IssuerACME     = "acme"     // Let's Encrypt / ZeroSSL, needs a publicly reachable domain
+	IssuerInternal = "internal" // Caddy's local CA, works offline
+)
+
+// Every issuer a tenant can have a policy for, in a stable order
+var tlsIssuers = []string{IssuerACME, IssuerInternal}
+
+// Certificates that expire sooner are flagged by "pilot proxy certs"
+const certRenewWarning = 14 * 24 * time.Hour
+
+// Suffixes of domains that no public CA issues certificates for
+var privateDomainSuffixes = []string{".localhost", ".local", ".internal", ".test", ".example", ".invalid", ".lan", ".home.arpa"}
+
+// domainIssuer returns the issuer for a domain: the internal CA for localhost,
+// private TLDs and IP addresses, ACME for everything else
+func domainIssuer(domain string) string {
+	host := strings.TrimPrefix(domain, "*.")
+	if host == "localhost" || net.ParseIP(host) != nil {
+		return IssuerInternal
+	}
+	for _, suffix := range privateDomainSuffixes {
+		if strings.HasSuffix(host, suffix) {
+			return IssuerInternal
+		}
+	}
+	return IssuerACME
+}
+
+// tlsPolicyID is the Caddy @id of a tenant's TLS automation policy for an issuer
+func tlsPolicyID(username, issuer string) string {
+	return fmt.Sprintf("tls-tenant-%s-%s", username, issuer)
+}
+
+// buildTLSPolicies returns the automation policies of a tenant's domains, one per
+// issuer in use, keyed by their @id. A missing policy must not exist.
+func buildTLSPolicies(username string, domains []string) map[string]*CaddyTLSPolicy {
+	policies := map[string]*CaddyTLSPolicy{}
+	for _, d := range domains {
+		issuer := domainIssuer(d)
+		id := tlsPolicyID(username, issuer)
+		if policies[id] == nil {
+			policies[id] = &CaddyTLSPolicy{
+				ID:      id,
+				Issuers: []map[string]interface{}{{"module": issuer}},
+			}
+		}
+		policies[id].Subjects = append(policies[id].Subjects, d)
+	}
+	return policies
+}
+
+// syncTLSPolicies creates, updates and removes the TLS automation policies of a tenant
+func syncTLSPolicies(client *CaddyClient, username string, domains []string) error {
+	policies := buildTLSPolicies(username, domains)
+	for _, issuer := range tlsIssuers {
+		id, policy := tlsPolicyID(username, issuer), policies[tlsPolicyID(username, issuer)]
+		if policy != nil {
+			if err := client.SetTLSPolicy(*policy); err != nil {
+				return fmt.Errorf("failed to configure TLS policy %s: %v", id, err)
+			}
+			continue
+		}
+		if err := removeTLSPolicy(client, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeTLSPolicies removes all TLS automation policies of a tenant
+func removeTLSPolicies(client *CaddyClient, username string) error {
+	for _, issuer := range tlsIssuers {
+		if err := removeTLSPolicy(client, tlsPolicyID(username, issuer)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func removeTLSPolicy(client *CaddyClient, id string) error {
+	raw, err := client.GetRouteJSON(id)
+	if err != nil {
+		return fmt.Errorf("failed to contact Caddy API: %v (is Caddy running?)", err)
+	}
+	if raw == nil {
+		return nil
+	}
+	if err := client.DeleteRoute(id); err != nil {
+		return fmt.Errorf("failed to remove TLS policy %s: %v", id, err)
+	}
+	return nil
+}
+
+// CertStatus is the certificate Caddy serves for a tenant domain
+type CertStatus struct {
+	Tenant   string
+	Domain   string
+	Issuer   string // issuer of the TLS policy (acme, internal)
+	IssuedBy string // common name of the certificate's issuer
+	NotAfter time.Time
+	Trusted  bool // valid for the domain and signed by a public or the internal CA
+	Err      error
+}
+
+// inspectCertificate fetches the certificate served for a domain and verifies it
+// against the system roots plus Caddy's internal CA
+func inspectCertificate(addr, domain string, roots *x509.CertPool) CertStatus {
+	s := CertStatus{Domain: domain, Issuer: domainIssuer(domain)}
+
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	conn, err := tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{
+		ServerName:         domain,
+		InsecureSkipVerify: true, // verified below, so untrusted certificates can be reported
+	})
+	if err != nil {
+		s.Err = err
+		return s
+	}
+	defer conn.Close()
+
+	chain := conn.ConnectionState().PeerCertificates
+	if len(chain) == 0 {
+		s.Err = fmt.Errorf("no certificate served")
+		return s
+	}
+	leaf := chain[0]
+	s.IssuedBy = leaf.Issuer.CommonName
+	s.NotAfter = leaf.NotAfter
+
+	intermediates := x509.NewCertPool()
+	for _, c := range chain[1:] {
+		intermediates.AddCert(c)
+	}
+	_, err = leaf.Verify(x509.VerifyOptions{DNSName: domain, Roots: roots, Intermediates: intermediates})
+	s.Trusted = err == nil
+	return s
+}
+
+// certRoots returns the system roots plus the root of Caddy's internal CA
+func certRoots(client *CaddyClient) *x509.CertPool {
+	roots, err := x509.SystemCertPool()
+	if err != nil {
+		roots = x509.NewCertPool()
+	}
+	if pem, err := client.LocalCARoot(); err == nil && pem != "" {
+		roots.AppendCertsFromPEM([]byte(pem))
+	}
+	return roots
+}
+
+var proxyCertsCmd = &cobra.Command{
+	Use:   "certs",
+	Short: "Shows the certificate status of every tenant domain",
+	Long: `Shows, for every domain of every managed tenant, which issuer its TLS policy uses
+(acme for public domains, internal for .localhost, private TLDs and IP addresses)
+and the certificate Caddy currently serves for it: issuer, expiry and whether it
+is trusted (by the system roots or Caddy's internal CA, fetched from the admin API).
+
+Caddy's admin API does not report the state of managed certificates, so they are
+read from a TLS handshake with the server's first listen address (on 127.0.0.1
+unless it listens on a specific host) using the domain as SNI.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		st, err := LoadState()
+		if err != nil {
+			log.Fatalf("❌ Error: %v", err)
+		}
+		if len(st.Tenants) == 0 {
+			fmt.Println("No tenants managed by pilot.")
+			return
+		}
+
+		client := NewCaddyClient("")
+		roots := certRoots(client)
+		addr := httpsProbeAddr(client.Listen)
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+		fmt.Fprintln(w, "TENANT\tDOMAIN\tISSUER\tISSUED BY\tEXPIRES\tSTATUS")
+		fmt.Fprintln(w, "------\t------\t------\t---------\t-------\t------")
+		for _, name := range st.Names() {
+			for _, domain := range tenantDomains(st.Tenants[name]) {
+				var s CertStatus
+				if strings.HasPrefix(domain, "*.") {
+					s = CertStatus{Domain: domain, Issuer: domainIssuer(domain), Err: fmt.Errorf("wildcard, not probed")}
+				} else {
+					s = inspectCertificate(addr, domain, roots)
+				}
+				s.Tenant = name
+				printCertStatus(w, s, time.Now())
+			}
+		}
+		w.Flush()
+	},
+}
+
+func printCertStatus(w *tabwriter.Writer, s CertStatus, now time.Time) {
+	if s.Err != nil {
+		fmt.Fprintf(w, "%s\t%s\t%s\t-\t-\t❌ %v\n", s.Tenant, s.Domain, s.Issuer, s.Err)
+		return
+	}
+	left := s.NotAfter.Sub(now)
+	status := "ok"
+	switch {
+	case left <= 0:
+		status = "❌ expired"
+	case !s.Trusted:
+		status = "⚠️  untrusted"
+	case left < certRenewWarning:
+		status = fmt.Sprintf("⚠️  expires in %dd", int(left.Hours()/24))
+	}
+	fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", s.Tenant, s.Domain, s.Issuer, orDash(s.IssuedBy), s.NotAfter.Local().Format("2006-01-02"), status)
+}
+
+func init() {
+	proxyCmd.AddCommand(proxyCertsCmd)
+}
@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestDomainIssuer(t *testing.T) {
+	tests := map[string]string{
+		"alice.localhost":     IssuerInternal,
+		"localhost":           IssuerInternal,
+		"shop.internal":       IssuerInternal,
+		"printer.home.arpa":   IssuerInternal,
+		"10.0.0.5":            IssuerInternal,
+		"alice.example.com":   IssuerACME,
+		"*.alice.example.com": IssuerACME,
+		"*.dev.localhost":     IssuerInternal,
+	}
+	for domain, want := range tests {
+		if got := domainIssuer(domain); got != want {
+			t.Errorf("domainIssuer(%q) = %q, want %q", domain, got, want)
+		}
+	}
+}
+
+func TestBuildTLSPolicies(t *testing.T) {
+	policies := buildTLSPolicies("alice", []string{"alice.example.com", "alice.localhost", "www.alice.example.com"})
+	if len(policies) != 2 {
+		t.Fatalf("got %d policies, want 2", len(policies))
+	}
+	acme := policies["tls-tenant-alice-acme"]
+	if acme == nil || !slices.Equal(acme.Subjects, []string{"alice.example.com", "www.alice.example.com"}) || acme.Issuers[0]["module"] != "acme" {
+		t.Errorf("unexpected acme policy: %+v", acme)
+	}
+	internal := policies["tls-tenant-alice-internal"]
+	if internal == nil || !slices.Equal(internal.Subjects, []string{"alice.localhost"}) {
+		t.Errorf("unexpected internal policy: %+v", internal)
+	}
+
+	if got := buildTLSPolicies("bob", []string{"bob.localhost"}); got["tls-tenant-bob-acme"] != nil {
+		t.Error("a tenant without public domains must not get an acme policy")
+	}
+}
+
+// An empty Caddy gets the TLS app and its policy list created before the policy is added
+func TestSetTLSPolicyBootstrap(t *testing.T) {
+	var calls []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, r.Method+" "+r.URL.Path)
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/id/"):
+			http.NotFound(w, r)
+		case r.Method == "GET":
+			w.Write([]byte("null\n"))
+		}
+	}))
+	defer srv.Close()
+
+	policy := *buildTLSPolicies("alice", []string{"alice.localhost"})["tls-tenant-alice-internal"]
+	if err := NewCaddyClient(srv.URL).SetTLSPolicy(policy); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"GET /config/", "POST /config/",
+		"GET /id/tls-tenant-alice-internal",
+		"GET /config/apps/tls/automation/policies",
+		"POST /config/apps/tls/automation/policies",
+	}
+	if !slices.Equal(calls, want) {
+		t.Errorf("calls = %v\nwant %v", calls, want)
+	}
+}
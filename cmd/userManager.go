@@ -0,0 +1,228 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-systemd/v22/dbus"
+	godbus "github.com/godbus/dbus/v5"
+)
+
+// How long to wait for a job (start, stop) of the user manager to finish
+const jobTimeout = 30 * time.Second
+
+// ErrManagerNotRunning is returned when the tenant's user manager has no bus
+var ErrManagerNotRunning = errors.New("user manager is not running")
+
+// UnitError is returned when the user manager rejects an operation
+type UnitError struct {
+	Username string
+	Op       string
+	Units    []string
+	Err      error
+}
+
+func (e *UnitError) Error() string {
+	if len(e.Units) == 0 {
+		return fmt.Sprintf("failed to %s for '%s': %v", e.Op, e.Username, e.Err)
+	}
+	return fmt.Sprintf("failed to %s %s for '%s': %v", e.Op, strings.Join(e.Units, ", "), e.Username, e.Err)
+}
+
+func (e *UnitError) Unwrap() error { return e.Err }
+
+// JobError is returned when a start or stop job did not finish with result "done"
+type JobError struct {
+	Username string
+	Op       string
+	Unit     string
+	Result   string // canceled, timeout, failed, dependency, skipped
+}
+
+func (e *JobError) Error() string {
+	return fmt.Sprintf("%s of %s for '%s' finished with result '%s'", e.Op, e.Unit, e.Username, e.Result)
+}
+
+// UserManager talks to the systemd user manager of a tenant over its D-Bus
+type UserManager struct {
+	username string
+	conn     *dbus.Conn // nil in dry-run mode if the manager does not run yet
+}
+
+// ConnectUserManager connects to /run/user/<uid>/bus as the tenant.
+// In dry-run mode a missing bus is not an error, since an earlier step would have started it.
+func ConnectUserManager(username string) (*UserManager, error) {
+	m := &UserManager{username: username}
+
+	u, err := lookupTenantUser(username)
+	if err != nil {
+		return nil, fmt.Errorf("could not find user %s: %v", username, err)
+	}
+
+	busPath := fmt.Sprintf("/run/user/%s/bus", u.Uid)
+	if _, err := os.Stat(busPath); err != nil {
+		if dryRun {
+			return m, nil
+		}
+		return nil, fmt.Errorf("%w for '%s' (%s missing)", ErrManagerNotRunning, username, busPath)
+	}
+
+	uid, err := strconv.Atoi(u.Uid)
+	if err != nil {
+		return nil, fmt.Errorf("invalid UID for user %s: %v", username, err)
+	}
+
+	conn, err := dbus.NewConnection(func() (*godbus.Conn, error) {
+		return dialUserBus(busPath, uid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to user manager of '%s': %v", username, err)
+	}
+	m.conn = conn
+	return m, nil
+}
+
+// dialUserBus opens an authenticated connection to a tenant's user bus.
+// The bus only admits its owner, so the socket is connected as the tenant (see asEffectiveUID).
+func dialUserBus(busPath string, uid int) (*godbus.Conn, error) {
+	var conn *godbus.Conn
+	err := asEffectiveUID(uid, func() error {
+		var err error
+		conn, err = godbus.Dial("unix:path=" + busPath)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := conn.Auth([]godbus.Auth{godbus.AuthExternal(strconv.Itoa(uid))}); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := conn.Hello(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// Close closes the connection to the user manager
+func (m *UserManager) Close() {
+	if m.conn != nil {
+		m.conn.Close()
+	}
+}
+
+// record prints a user manager operation instead of running it (dry-run)
+func (m *UserManager) record(op string, units ...string) {
+	recordChange("systemd", strings.TrimSpace(fmt.Sprintf("(as %s) %s %s", m.username, op, strings.Join(units, " "))), "")
+}
+
+// DaemonReload makes the user manager re-read all unit files
+func (m *UserManager) DaemonReload() error {
+	if dryRun {
+		m.record("daemon-reload")
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), jobTimeout)
+	defer cancel()
+	if err := m.conn.ReloadContext(ctx); err != nil {
+		return &UnitError{Username: m.username, Op: "daemon-reload", Err: err}
+	}
+	return nil
+}
+
+// Enable enables unit files (like "systemctl --user enable") and reloads the manager
+func (m *UserManager) Enable(units ...string) error {
+	if dryRun {
+		m.record("enable", units...)
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), jobTimeout)
+	defer cancel()
+	if _, _, err := m.conn.EnableUnitFilesContext(ctx, units, false, true); err != nil {
+		return &UnitError{Username: m.username, Op: "enable", Units: units, Err: err}
+	}
+	return m.DaemonReload()
+}
+
+// Disable disables unit files (like "systemctl --user disable") and reloads the manager
+func (m *UserManager) Disable(units ...string) error {
+	if dryRun {
+		m.record("disable", units...)
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), jobTimeout)
+	defer cancel()
+	if _, err := m.conn.DisableUnitFilesContext(ctx, units, false); err != nil {
+		return &UnitError{Username: m.username, Op: "disable", Units: units, Err: err}
+	}
+	return m.DaemonReload()
+}
+
+// Start starts units and waits for their jobs to finish
+func (m *UserManager) Start(units ...string) error {
+	return m.runJobs("start", units, m.conn.StartUnitContext)
+}
+
+// Stop stops units and waits for their jobs to finish. Units that are not loaded are skipped.
+func (m *UserManager) Stop(units ...string) error {
+	return m.runJobs("stop", units, m.conn.StopUnitContext)
+}
+
+// runJobs queues a job per unit and waits for its result
+func (m *UserManager) runJobs(op string, units []string, queue func(context.Context, string, string, chan<- string) (int, error)) error {
+	if dryRun {
+		m.record(op, units...)
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), jobTimeout)
+	defer cancel()
+
+	for _, unit := range units {
+		done := make(chan string, 1)
+		if _, err := queue(ctx, unit, "replace", done); err != nil {
+			var dbusErr godbus.Error
+			if op == "stop" && errors.As(err, &dbusErr) && dbusErr.Name == "org.freedesktop.systemd1.NoSuchUnit" {
+				continue
+			}
+			return &UnitError{Username: m.username, Op: op, Units: []string{unit}, Err: err}
+		}
+
+		select {
+		case result := <-done:
+			if result != "done" {
+				return &JobError{Username: m.username, Op: op, Unit: unit, Result: result}
+			}
+		case <-ctx.Done():
+			return &JobError{Username: m.username, Op: op, Unit: unit, Result: "timeout"}
+		}
+	}
+	return nil
+}
+
+// ActiveStates returns the ActiveState of each unit ("active", "inactive", "failed", ...)
+func (m *UserManager) ActiveStates(units ...string) (map[string]string, error) {
+	if m.conn == nil {
+		return nil, fmt.Errorf("%w for '%s'", ErrManagerNotRunning, m.username)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), jobTimeout)
+	defer cancel()
+	statuses, err := m.conn.ListUnitsByNamesContext(ctx, units)
+	if err != nil {
+		return nil, &UnitError{Username: m.username, Op: "query", Units: units, Err: err}
+	}
+
+	states := map[string]string{}
+	for _, s := range statuses {
+		states[s.Name] = s.ActiveState
+	}
+	return states, nil
+}
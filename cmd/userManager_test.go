@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestUserCommandNoShell(t *testing.T) {
+	cmd, err := userCommand("root", "echo", "a b; rm -rf /")
+	if err != nil {
+		t.Skipf("user root not available: %v", err)
+	}
+	want := []string{"runuser", "-u", "root", "--", "env", "XDG_RUNTIME_DIR=/run/user/0",
+		"DBUS_SESSION_BUS_ADDRESS=unix:path=/run/user/0/bus", "echo", "a b; rm -rf /"}
+	if !slices.Equal(cmd.Args, want) {
+		t.Errorf("userCommand() args = %q, want %q", cmd.Args, want)
+	}
+}
+
+func TestUnitErrorUnwrap(t *testing.T) {
+	cause := errors.New("access denied")
+	var err error = &UnitError{Username: "alice", Op: "enable", Units: []string{"rest-api.socket"}, Err: cause}
+	if !errors.Is(err, cause) {
+		t.Error("UnitError does not unwrap to its cause")
+	}
+	if got, want := err.Error(), "failed to enable rest-api.socket for 'alice': access denied"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+
+	var jobErr *JobError
+	err = &JobError{Username: "alice", Op: "start", Unit: "rest-api.socket", Result: "failed"}
+	if !errors.As(err, &jobErr) || jobErr.Result != "failed" {
+		t.Errorf("errors.As(JobError) = %+v", jobErr)
+	}
+}
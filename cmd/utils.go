@@ -8,7 +8,7 @@ import (
 	osuser "os/user"
 	"regexp"
 	"strconv"
-	"strings"
+	"syscall"
 )
 
 var userRegex = regexp.MustCompile(`^[a-z0-9_-]+$`) // Enforce safe usernames
@@ -17,6 +17,9 @@ var userRegex = regexp.MustCompile(`^[a-z0-9_-]+$`) // Enforce safe usernames
 // LogAction logs an administrative action to the centralized log file
 func LogAction(action, user, status string) {
 	logMsg := fmt.Sprintf("ACTION=%s USER=%s STATUS=%s", action, user, status)
+	if dryRun {
+		logMsg += " DRY_RUN=true"
+	}
 
 	// Try to append to central log file
 	f, err := os.OpenFile("/var/log/pilot.log", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
@@ -34,36 +37,95 @@ func LogAction(action, user, status string) {
 // runAsUser executes a command as a specific user using runuser.
 // It assumes the current process has root privileges for runuser.
 func runAsUser(username string, command ...string) error {
+	if dryRun {
+		recordChange("exec", fmt.Sprintf("(as %s) %s", username, shellJoin(command)), "")
+		return nil
+	}
+
+	cmd, err := userCommand(username, command...)
+	if err != nil {
+		return err
+	}
+
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to run command as user '%s': %v", username, err)
+	}
+	return nil
+}
+
+// outputAsUser is like runAsUser but returns the combined output instead of printing it.
+// The output is returned even if the command exits non-zero (e.g. "systemctl is-active").
+func outputAsUser(username string, command ...string) (string, error) {
+	cmd, err := userCommand(username, command...)
+	if err != nil {
+		return "", err
+	}
+
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return string(out), fmt.Errorf("failed to run command as user '%s': %v", username, err)
+	}
+	return string(out), nil
+}
+
+// userCommand prepares a runuser command with the user's systemd bus environment.
+// The arguments are passed to the command as they are, never through a shell.
+func userCommand(username string, command ...string) (*exec.Cmd, error) {
+	if len(command) == 0 {
+		return nil, fmt.Errorf("no command given")
+	}
+
 	// 1. Get the UID (needed for the path /run/user/UID)
 	u, err := osuser.Lookup(username) // Use osuser.Lookup
 	if err != nil {
-		return fmt.Errorf("user lookup failed: %v", err)
+		return nil, fmt.Errorf("user lookup failed: %v", err)
 	}
 
 	// 2. Construct the environment variables manually
-	// This tells systemctl exactly where to find the bus
+	// This tells systemd tools exactly where to find the bus
 	xdgRuntime := fmt.Sprintf("XDG_RUNTIME_DIR=/run/user/%s", u.Uid)
 	dbusAddr := fmt.Sprintf("DBUS_SESSION_BUS_ADDRESS=unix:path=/run/user/%s/bus", u.Uid)
 
 	// 3. Prepare the command
-	// We use "runuser" with "-u user -- command"
-	// But we wrap it in /bin/bash to inject the variables cleanly
-	fullCmd := fmt.Sprintf("export %s; export %s; %s", xdgRuntime, dbusAddr, strings.Join(command, " "))
-
-	cmd := exec.Command("runuser", "-u", username, "--", "/bin/bash", "-c", fullCmd)
-
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	// "runuser -u user -- env VAR=... command args..." sets the variables without a shell
+	args := append([]string{"-u", username, "--", "env", xdgRuntime, dbusAddr}, command...)
+	return exec.Command("runuser", args...), nil
+}
 
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to run command as user '%s': %v", username, err)
+// asEffectiveUID runs fn with the effective UID switched to uid and switches back to root.
+// Unix sockets record the peer credentials at connect(), so services that authenticate
+// by peer credentials (the user bus, PostgreSQL peer auth) see uid for the whole connection.
+// Seteuid affects every thread of the process; pilot does nothing else meanwhile.
+func asEffectiveUID(uid int, fn func() error) error {
+	if os.Geteuid() == uid {
+		return fn()
 	}
-	return nil
+	if os.Geteuid() != 0 {
+		return fmt.Errorf("must run as root to act as UID %d", uid)
+	}
+	if err := syscall.Seteuid(uid); err != nil {
+		return fmt.Errorf("failed to switch to UID %d: %v", uid, err)
+	}
+	defer func() {
+		if err := syscall.Seteuid(0); err != nil {
+			// Continuing without root would fail in confusing ways later on
+			log.Fatalf("❌ Failed to restore root privileges: %v", err)
+		}
+	}()
+	return fn()
 }
 
 // writeAsUser writes content to a file and sets its ownership to the specified user.
 // It assumes the current process has root privileges to write and chown files.
 func writeAsUser(username string, content string, filePath string) error {
+	if dryRun {
+		recordChange("write", fmt.Sprintf("%s (owner %s)", filePath, username), content)
+		return nil
+	}
+
 	// Write content to file
 	err := os.WriteFile(filePath, []byte(content), 0644) // Default file permissions
 	if err != nil {
@@ -3,12 +3,17 @@ module pilot
 go 1.25.4
 
 require (
-	github.com/coreos/go-systemd/v22 v22.6.0 // indirect
-	github.com/go-faker/faker/v4 v4.7.0 // indirect
-	github.com/godbus/dbus/v5 v5.1.0 // indirect
+	github.com/coreos/go-systemd/v22 v22.6.0
+	github.com/go-faker/faker/v4 v4.7.0
+	github.com/godbus/dbus/v5 v5.1.0
+	github.com/lib/pq v1.10.9
+	github.com/spf13/cobra v1.10.2
+	golang.org/x/crypto v0.42.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
-	github.com/lib/pq v1.10.9 // indirect
-	github.com/spf13/cobra v1.10.2 // indirect
 	github.com/spf13/pflag v1.0.9 // indirect
 	golang.org/x/text v0.29.0 // indirect
 )
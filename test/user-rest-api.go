@@ -5,10 +5,14 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/user"
+	"sync"
+	"time"
 
+	"github.com/coreos/go-systemd/v22/activation"
 	_ "github.com/lib/pq"
 )
 
@@ -21,8 +25,14 @@ type info struct {
 }
 
 func main() {
+	// Socket activation (pilot --activation=direct): systemd passes the listening socket
+	listeners, err := activation.Listeners()
+	if err != nil {
+		log.Fatalf("Failed to read inherited sockets: %v", err)
+	}
+
 	portEnv := os.Getenv("PORT")
-	if portEnv == "" {
+	if portEnv == "" && len(listeners) == 0 {
 		log.Fatal("Please Set PORT ENV VAR")
 	}
 
@@ -60,6 +70,65 @@ func main() {
 		w.Write(response)
 	})
 	
+	if len(listeners) > 0 {
+		serveActivated(listeners[0], os.Getenv("IDLE_TIMEOUT"))
+		return
+	}
+
 	log.Println("Starting Json API on port", portEnv)
 	log.Fatal(http.ListenAndServe(":"+portEnv, nil))
+}
+
+// serveActivated serves on a socket inherited from systemd and exits once no
+// connection was open for the idle timeout. The socket stays with systemd,
+// so the next request simply starts the service again.
+func serveActivated(l net.Listener, idle string) {
+	timeout := 5 * time.Minute
+	if idle != "" {
+		d, err := time.ParseDuration(idle)
+		if err != nil {
+			log.Fatalf("Invalid IDLE_TIMEOUT %q: %v", idle, err)
+		}
+		timeout = d
+	}
+
+	var mu sync.Mutex
+	active := 0
+	idleTimer := time.NewTimer(timeout)
+
+	srv := &http.Server{
+		ConnState: func(c net.Conn, state http.ConnState) {
+			mu.Lock()
+			defer mu.Unlock()
+			switch state {
+			case http.StateNew:
+				active++
+				idleTimer.Stop()
+			case http.StateHijacked, http.StateClosed:
+				active--
+				if active == 0 {
+					idleTimer.Reset(timeout)
+				}
+			}
+		},
+	}
+
+	go func() {
+		for range idleTimer.C {
+			// A connection may have arrived just as the timer fired
+			mu.Lock()
+			busy := active > 0
+			mu.Unlock()
+			if !busy {
+				break
+			}
+		}
+		log.Printf("No connections for %s, exiting", timeout)
+		srv.Close()
+	}()
+
+	log.Println("Starting Json API on inherited socket", l.Addr())
+	if err := srv.Serve(l); err != nil && err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
 }
\ No newline at end of file